@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/Martins-Iroka/social/internal/auth"
 	"github.com/Martins-Iroka/social/internal/env"
 	"github.com/Martins-Iroka/social/internal/mailer"
+	"github.com/Martins-Iroka/social/internal/policy"
 	"github.com/Martins-Iroka/social/internal/ratelimiter"
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/Martins-Iroka/social/internal/store/cache"
@@ -34,17 +36,42 @@ type application struct {
 	authenticator auth.Authenticator
 	cacheStorage  cache.Storage
 	ratelimiter   ratelimiter.Limiter
+	// emailRateLimiter is keyed by email address instead of ip
+	emailRateLimiter ratelimiter.Limiter
+	// oidcProviders are keyed by the name used in the login URLs
+	oidcProviders map[string]*auth.OIDCProvider
 }
 
 type authConfig struct {
 	basic basicConfig
 	token tokenConfig
+	oidc  oidcConfig
+	// totpKey is the base64 encoded key the TOTP secrets are encrypted with,
+	// the TOTP endpoints answer 503 when it's empty
+	totpKey string
+}
+
+type oidcConfig struct {
+	providers map[string]auth.OIDCConfig
+	// stateExp is how long a user has to log in with the provider
+	stateExp time.Duration
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
+	secret     string
+	exp        time.Duration
+	refreshExp time.Duration
+	// mfaExp is how long a user has to enter their second factor
+	mfaExp time.Duration
 	iss    string
+	// keyFile is a PEM RSA or Ed25519 private key, tokens are signed with
+	// secret (HS256) when it's empty. It requires keyID.
+	keyFile string
+	keyID   string
+	// previousKeys are "kid=path" pairs, comma separated, of the keys that
+	// only validate the tokens they signed before a rotation. "kid=hmac"
+	// keeps secret as such a key after moving to a keyFile.
+	previousKeys string
 }
 
 type basicConfig struct {
@@ -61,6 +88,18 @@ type config struct {
 	auth        authConfig
 	redisCfg    redisConfig
 	rateLimiter ratelimiter.Config
+	// emailRateLimiter limits the emails a single address can be sent on request
+	emailRateLimiter ratelimiter.Config
+	janitor          janitorConfig
+	outbox           outboxConfig
+	timeline         timelineConfig
+}
+
+type janitorConfig struct {
+	enabled  bool
+	interval time.Duration
+	// gracePeriod is how long a registered account has to be activated before it's deleted
+	gracePeriod time.Duration
 }
 
 type redisConfig struct {
@@ -70,10 +109,15 @@ type redisConfig struct {
 }
 
 type mailConfig struct {
-	sendGrid  sendGridConfig
-	fromEmail string
-	expiry    time.Duration
-	mailTrap  mailTrapConfig
+	// provider is one of sendgrid, mailtrap, smtp or dev
+	provider            string
+	sendGrid            sendGridConfig
+	smtp                mailer.SMTPConfig
+	devDir              string
+	fromEmail           string
+	expiry              time.Duration
+	passwordResetExpiry time.Duration
+	mailTrap            mailTrapConfig
 }
 
 type sendGridConfig struct {
@@ -113,6 +157,7 @@ func (app *application) mount() *chi.Mux {
 	r.Use(middleware.Timeout(60 * time.Second))
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/health", app.healthCheckHandler)
+		r.Get("/.well-known/jwks.json", app.jwksHandler)
 		r.With(app.basicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
@@ -120,6 +165,7 @@ func (app *application) mount() *chi.Mux {
 
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.authTokenMiddleware)
+			r.Get("/", app.listPostsHandler)
 			r.Post("/", app.createPostHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
@@ -127,34 +173,99 @@ func (app *application) mount() *chi.Mux {
 
 				r.Get("/", app.getPostHandler)
 
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
+				r.Delete("/", app.checkPostOwnership(policy.PostsDeleteAny, app.deletePostHandler))
+
+				r.Put("/", app.checkPostOwnership(policy.PostsUpdateAny, app.updatePostHandler))
 
-				r.Put("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				// Idempotency
+				r.Put("/reactions/{kind}", app.reactToPostHandler)
+				r.Delete("/reactions/{kind}", app.removeReactionHandler)
 
 				r.Post("/comments", app.createCommentPostHandler)
+				r.Get("/comments", app.listCommentsHandler)
+
+				r.Route("/comments/{commentID}", func(r chi.Router) {
+					r.Use(app.commentsContextMiddleware)
+
+					r.Get("/", app.getCommentThreadHandler)
+					r.Put("/", app.checkCommentOwnership(policy.CommentsUpdateAny, app.updateCommentHandler))
+					r.Delete("/", app.checkCommentOwnership(policy.CommentsModerate, app.deleteCommentHandler))
+
+					r.Post("/replies", app.createReplyHandler)
+					r.Get("/replies", app.listRepliesHandler)
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Post("/activate/resend", app.resendActivationHandler)
 
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.authTokenMiddleware)
 				r.Get("/", app.getUserHandler)
+				r.Get("/posts", app.getUserPostsHandler)
+				r.Get("/followers", app.getFollowersHandler)
+				r.Get("/following", app.getFollowingHandler)
 
 				// Idempotency
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Put("/block", app.blockUserHandler)
+				r.Delete("/block", app.unblockUserHandler)
+				r.Put("/mute", app.muteUserHandler)
+				r.Delete("/mute", app.unmuteUserHandler)
+
+				r.Delete("/sessions", app.requirePermission(policy.UsersRevokeSessions, app.revokeUserSessionsHandler))
+				r.Put("/role", app.requirePermission(policy.RolesManage, app.assignRoleHandler))
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(app.authTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/suggestions", app.getFollowSuggestionsHandler)
+				r.Put("/privacy", app.setPrivacyHandler)
+				r.Get("/follow-requests", app.listFollowRequestsHandler)
+				r.Put("/follow-requests/{userID}/approve", app.approveFollowRequestHandler)
+				r.Put("/follow-requests/{userID}/deny", app.denyFollowRequestHandler)
 			})
 		})
 
+		r.Route("/roles", func(r chi.Router) {
+			r.Use(app.authTokenMiddleware)
+			r.Get("/", app.requirePermission(policy.RolesManage, app.listRolesHandler))
+			r.Post("/", app.requirePermission(policy.RolesManage, app.createRoleHandler))
+			r.Put("/{roleID}", app.requirePermission(policy.RolesManage, app.updateRoleHandler))
+			r.Put("/{roleID}/permissions", app.requirePermission(policy.RolesManage, app.setRolePermissionsHandler))
+		})
+
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.With(app.authTokenMiddleware).Post("/logout", app.logoutHandler)
+
+			r.Route("/password", func(r chi.Router) {
+				r.Post("/forgot", app.forgotPasswordHandler)
+				r.Put("/reset/{token}", app.resetPasswordHandler)
+			})
+
+			r.Route("/mfa", func(r chi.Router) {
+				r.Post("/", app.verifyMFAHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.authTokenMiddleware)
+
+					r.Post("/totp", app.enrollTOTPHandler)
+					r.Put("/totp", app.confirmTOTPHandler)
+					r.Delete("/totp", app.disableTOTPHandler)
+					r.Post("/recovery-codes", app.regenerateRecoveryCodesHandler)
+				})
+			})
+
+			r.Route("/oidc/{provider}", func(r chi.Router) {
+				r.Get("/start", app.oidcStartHandler)
+				r.Get("/callback", app.oidcCallbackHandler)
+			})
 		})
 
 	})
@@ -178,6 +289,30 @@ func (app *application) run(mux http.Handler) error {
 
 	shutdown := make(chan error)
 
+	// background jobs stop with the server, and it waits for them so the
+	// outbox workers can report the emails they are sending
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if app.config.janitor.enabled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.runJanitor(ctx)
+		}()
+	}
+
+	if app.config.outbox.enabled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.runOutboxWorkers(ctx)
+		}()
+	}
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
-	"github.com/Martins-Iroka/social/internal/mailer"
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -17,8 +19,14 @@ type RegisterUserPayload struct {
 	Username string `json:"username" validate:"required,max=100"`
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=3,max=72"`
+	// Locale picks the language of the emails, e.g. "fr"
+	Locale string `json:"locale" validate:"omitempty,max=16,bcp47_language_tag"`
 }
 
+type claimsKey string
+
+const claimsContextKey claimsKey = "claims"
+
 type UserWithToken struct {
 	*store.User
 	Token string `json:"token"`
@@ -51,6 +59,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	user := &store.User{
 		Username: payload.Username,
 		Email:    payload.Email,
+		Locale:   payload.Locale,
 		Role: store.Role{
 			Name: "user",
 		},
@@ -69,7 +78,14 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	hash := sha256.Sum256([]byte(token))
 	hashToken := hex.EncodeToString(hash[:])
 
-	if err := app.store.User.CreateAndInviteUser(ctx, user, hashToken, app.config.mail.expiry); err != nil {
+	// the invitation email is sent by the outbox workers once the user is committed
+	email, err := app.newInvitationEmail(user, token)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.User.CreateAndInviteUser(ctx, user, hashToken, app.config.mail.expiry, email); err != nil {
 		switch err {
 		case store.ErrorDuplicateEmail, store.ErrorDuplicateUsername:
 			app.badRequestResponse(w, r, err)
@@ -84,30 +100,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Token: token,
 	}
 
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, token)
-
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
-	// this is synchronous because jsonResponse waits for this function to return before running.
-	// a message queue could solve this.
-	err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
-	if err != nil {
-		app.logger.Errorw("error sending welcome email", "error", err)
-
-		// rollback user creation if email fails (SAGA pattern)
-		if err := app.store.User.DeleteUser(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
-		}
-		app.internalServerError(w, r, err)
-		return
-	}
 	if err := jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -121,12 +113,13 @@ type CreateUserTokenPayload struct {
 // CreateTokenHandler godoc
 //
 //	@summary		Creates a token
-//	@description	Creates a token for a user
+//	@description	Creates an access token and a refresh token for a user. Users with two-factor authentication get an MFA challenge instead, to complete at /authentication/mfa.
 //	@tags			authentication
 //	@accept			json
 //	@produce		json
 //	@param			payload	body		CreateUserTokenPayload	true	"User credentials"
-//	@success		200		{string}	string					"Token"
+//	@success		201		{object}	TokenPair				"Tokens"
+//	@success		202		{object}	MFAChallenge			"Second factor required"
 //	@failure		400		{object}	error
 //	@failure		401		{object}	error
 //	@failure		500		{object}	error
@@ -160,22 +153,239 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// generate the token -> add claims
+	// generate the tokens -> access token with claims and a refresh token,
+	// or the challenge of the second factor
+	app.issueTokens(w, r, user, []string{amrPassword})
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// RefreshTokenHandler godoc
+//
+//	@summary		Refreshes a token
+//	@description	Exchanges a refresh token for a new access token and refresh token. The refresh token can only be used once.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@success		201		{object}	TokenPair			"Tokens"
+//	@failure		400		{object}	error
+//	@failure		401		{object}	error
+//	@failure		500		{object}	error
+//	@Router			/authentication/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	refreshToken, err := app.authenticator.GenerateRefreshToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	rt, err := app.store.RefreshTokens.Rotate(ctx, payload.RefreshToken, refreshToken, app.config.auth.token.refreshExp)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound, store.ErrorRefreshTokenReused:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the user could have been deleted or deactivated since the token was issued
+	if _, err := app.store.User.GetUserByID(ctx, rt.UserID); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	accessToken, err := app.generateAccessToken(rt.UserID, rt.AMR)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens := TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}
+
+	if err := jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutHandler godoc
+//
+//	@summary		Logs out a user
+//	@description	Revokes the access token used for the request and, if given, the session of the refresh token
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		LogoutPayload	false	"Refresh token of the session"
+//	@success		204		{string}	string			"Logged out"
+//	@failure		400		{object}	error
+//	@failure		401		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@Router			/authentication/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	// the body is optional, an access token alone can be logged out
+	var payload LogoutPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	claims := getClaimsFromContext(r)
+	ctx := r.Context()
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has no expiration"))
+		return
+	}
+
+	if err := app.revokeToken(ctx, claims, user.ID, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		if err := app.store.RefreshTokens.Revoke(ctx, payload.RefreshToken, user.ID); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revokeToken blacklists the jti of claims until the token expires.
+func (app *application) revokeToken(ctx context.Context, claims jwt.MapClaims, userID int64, exp time.Time) error {
+	jti, _ := claims["jti"].(string)
+
+	if err := app.store.Revocations.Revoke(ctx, jti, userID, exp); err != nil {
+		return err
+	}
+
+	if app.config.redisCfg.enabled {
+		return app.cacheStorage.Revocations.Set(ctx, jti, true, time.Until(exp))
+	}
+
+	return nil
+}
+
+// revokeAllSessions logs the user out everywhere.
+func (app *application) revokeAllSessions(ctx context.Context, userID int64) error {
+	revokedAt, err := app.store.Revocations.RevokeAllForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if app.config.redisCfg.enabled {
+		return app.cacheStorage.Revocations.SetUserCutoff(ctx, userID, revokedAt, app.config.auth.token.exp)
+	}
+
+	return nil
+}
+
+func getClaimsFromContext(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(claimsContextKey).(jwt.MapClaims)
+	return claims
+}
+
+// createTokenPair starts a new refresh token family for the user, amr are the
+// methods the user authenticated with.
+func (app *application) createTokenPair(ctx context.Context, userID int64, amr []string) (*TokenPair, error) {
+	refreshToken, err := app.authenticator.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rt := &store.RefreshToken{
+		UserID:   userID,
+		FamilyID: uuid.New().String(),
+		AMR:      amr,
+		Expiry:   time.Now().Add(app.config.auth.token.refreshExp),
+	}
+
+	if err := app.store.RefreshTokens.Create(ctx, refreshToken, rt); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := app.generateAccessToken(userID, amr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
+}
+
+func (app *application) generateAccessToken(userID int64, amr []string) (string, error) {
 	claims := jwt.MapClaims{
-		"sub": user.ID,
+		"sub": userID,
 		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
 		"iat": time.Now().Unix(),
 		"nbf": time.Now().Unix(),
 		"iss": app.config.auth.token.iss,
 		"aud": app.config.auth.token.iss,
+		"jti": uuid.New().String(),
+		"amr": amr,
 	}
-	token, err := app.authenticator.GenerateToken(claims)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		return
-	}
-	// send it to the client
-	if err := jsonResponse(w, http.StatusCreated, token); err != nil {
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// JWKS godoc
+//
+//	@summary		Publishes the token signing keys
+//	@description	The public keys tokens are signed with, as a JSON Web Key Set, so other services can verify them. HS256 secrets are never published.
+//	@tags			authentication
+//	@produce		json
+//	@success		200	{object}	auth.JWKS
+//	@router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// the key set isn't wrapped in the data envelope, clients expect it as is
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := writeJSON(w, http.StatusOK, app.authenticator.JWKS()); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
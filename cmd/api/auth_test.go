@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRefreshToken(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	t.Run("should rotate a valid refresh token", func(t *testing.T) {
+		body := strings.NewReader(`{"refresh_token": "valid-refresh-token"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data TokenPair `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Data.AccessToken == "" || res.Data.RefreshToken == "" {
+			t.Errorf("expected a new token pair; got %+v", res.Data)
+		}
+
+		if res.Data.RefreshToken == "valid-refresh-token" {
+			t.Error("expected the refresh token to be rotated")
+		}
+	})
+
+	t.Run("should reject a reused refresh token", func(t *testing.T) {
+		body := strings.NewReader(`{"refresh_token": "` + store.MockReusedRefreshToken + `"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should require a refresh token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/logout", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should revoke the token with or without a refresh token", func(t *testing.T) {
+		for _, body := range []string{"", `{"refresh_token": "valid-refresh-token"}`} {
+			req, err := http.NewRequest(http.MethodPost, "/v1/authentication/logout", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusNoContent, rr.Code)
+		}
+	})
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	adminToken := newTestToken(t, app, store.MockAdminID)
+
+	oldToken, err := app.authenticator.GenerateToken(jwt.MapClaims{
+		"sub": int64(42),
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Add(-2 * time.Second).Unix(),
+		"jti": "old-jti",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, "/v1/users/42/sessions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	rr := executeRequest(req, mux)
+
+	checkResponseCode(t, http.StatusNoContent, rr.Code)
+
+	t.Run("should reject a token issued before the revoke", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/42/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+oldToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should accept a token issued right after the revoke", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/42/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestToken(t, app, 42))
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+var errSelfRelationship = errors.New("you can't do that to yourself")
+
+// Block User godoc
+//
+//	@summary		Blocks a user
+//	@description	Blocks a user by ID and removes the follows between the two users. Blocked users can't follow, comment on or see the posts of the blocker.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@success		204		{string}	string	"User blocked"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"User not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/block	[put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelationship(w, r, func(ctx context.Context, userID, targetID int64) error {
+		if err := app.store.Blocks.Block(ctx, userID, targetID); err != nil {
+			return err
+		}
+
+		// both lost a follow
+		app.invalidateTimeline(ctx, targetID)
+		return nil
+	})
+}
+
+// Unblock User godoc
+//
+//	@summary		Unblocks a user
+//	@description	Unblocks a user by ID, the follows removed by the block aren't restored
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@success		204		{string}	string	"User unblocked"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"User not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/block	[delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelationship(w, r, app.store.Blocks.Unblock)
+}
+
+// Mute User godoc
+//
+//	@summary		Mutes a user
+//	@description	Mutes a user by ID, their posts are hidden from the caller's feed
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@success		204		{string}	string	"User muted"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"User not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/mute	[put]
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelationship(w, r, app.store.Blocks.Mute)
+}
+
+// Unmute User godoc
+//
+//	@summary		Unmutes a user
+//	@description	Unmutes a user by ID
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@success		204		{string}	string	"User unmuted"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"User not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/mute	[delete]
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateRelationship(w, r, app.store.Blocks.Unmute)
+}
+
+// updateRelationship applies an idempotent change between the caller and the
+// user in the URL, then drops the caller's timeline as it may have changed.
+func (app *application) updateRelationship(w http.ResponseWriter, r *http.Request, update func(ctx context.Context, userID, targetID int64) error) {
+	targetID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	if targetID == user.ID {
+		app.badRequestResponse(w, r, errSelfRelationship)
+		return
+	}
+
+	ctx := r.Context()
+
+	target, err := app.getUser(ctx, targetID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := update(ctx, user.ID, target.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateTimeline(ctx, user.ID)
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBlocksAndMutes(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{"should block a user", http.MethodPut, "/v1/users/7/block", http.StatusNoContent},
+		{"should unblock a user", http.MethodDelete, "/v1/users/7/block", http.StatusNoContent},
+		{"should mute a user", http.MethodPut, "/v1/users/7/mute", http.StatusNoContent},
+		{"should unmute a user", http.MethodDelete, "/v1/users/7/mute", http.StatusNoContent},
+		{"should not block yourself", http.MethodPut, "/v1/users/42/block", http.StatusBadRequest},
+		{"should not mute yourself", http.MethodPut, "/v1/users/42/mute", http.StatusBadRequest},
+		{"should reject an invalid user id", http.MethodPut, "/v1/users/seven/block", http.StatusBadRequest},
+		{"should not block a missing user", http.MethodPut, "/v1/users/404/block", http.StatusNotFound},
+		{"should not mute a missing user", http.MethodPut, "/v1/users/404/mute", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestBlockedInteractions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"should not follow a user who blocked you", http.MethodPut, "/v1/users/13/follow", `{"user_id": 13}`, http.StatusForbidden},
+		{"should hide the posts of a user who blocked you", http.MethodGet, "/v1/posts/13", "", http.StatusNotFound},
+		{"should not comment on the posts of a user who blocked you", http.MethodPost, "/v1/posts/13/comments", `{"content": "hi"}`, http.StatusNotFound},
+		{"should not react to the posts of a user who blocked you", http.MethodPut, "/v1/posts/13/reactions/like", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+// ListComments godoc
+//
+//	@Summary		Lists the comments of a post
+//	@Description	Lists the top level comments of a post, newest first by default. Pass next_cursor as cursor to get the next page.
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			cursor	query		string	false	"Cursor"
+//	@Param			order	query		string	false	"Order (asc or desc)"
+//	@Success		200		{object}	[]store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [get]
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	commentQuery, err := readCommentQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comments, next, err := app.store.Comment.ListByPostID(r.Context(), post.ID, commentQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonPaginatedResponse(w, http.StatusOK, comments, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetCommentThread godoc
+//
+//	@Summary		Fetches a comment thread
+//	@Description	Fetches a comment with its replies nested up to depth levels, at most limit replies per comment, oldest first
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Param			depth		query		int	false	"Depth (0 to 5)"
+//	@Param			limit		query		int	false	"Replies per comment"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [get]
+func (app *application) getCommentThreadHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	tq := CommentThreadQueryAPi{
+		Depth: 3,
+		Limit: 10,
+	}
+
+	tq, err := tq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(tq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	thread, err := app.store.Comment.GetThread(r.Context(), comment.ID, &store.CommentThreadQuery{
+		Depth: tq.Depth,
+		Limit: tq.Limit,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, thread); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// CreateReply godoc
+//
+//	@Summary		Replies to a comment
+//	@Description	Creates a comment as a reply to another comment of the same post
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int				true	"Post ID"
+//	@Param			commentID	path		int				true	"Comment ID"
+//	@Param			payload		body		CommentPayload	true	"Comment payload"
+//	@Success		201			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/replies [post]
+func (app *application) createReplyHandler(w http.ResponseWriter, r *http.Request) {
+	parent := getCommentFromCtx(r)
+
+	var payload CommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	reply := &store.Comment{
+		Content:  payload.Content,
+		PostID:   parent.PostID,
+		ParentID: &parent.ID,
+		UserID:   user.ID,
+	}
+
+	if err := app.store.Comment.CreateComment(r.Context(), reply); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorBlocked):
+			app.forbiddenErrorResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusCreated, reply); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ListReplies godoc
+//
+//	@Summary		Lists the replies to a comment
+//	@Description	Lists the direct replies to a comment, newest first by default. Pass next_cursor as cursor to get the next page.
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int		true	"Post ID"
+//	@Param			commentID	path		int		true	"Comment ID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			cursor		query		string	false	"Cursor"
+//	@Param			order		query		string	false	"Order (asc or desc)"
+//	@Success		200			{object}	[]store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID}/replies [get]
+func (app *application) listRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	commentQuery, err := readCommentQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	replies, next, err := app.store.Comment.ListReplies(r.Context(), comment.ID, commentQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonPaginatedResponse(w, http.StatusOK, replies, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateComment godoc
+//
+//	@Summary		Updates a comment
+//	@Description	Updates the content of a comment. Other users' comments can only be edited by an admin.
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int				true	"Post ID"
+//	@Param			commentID	path		int				true	"Comment ID"
+//	@Param			payload		body		CommentPayload	true	"Comment payload"
+//	@Success		200			{object}	store.Comment
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [put]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	var payload CommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.store.Comment.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DeleteComment godoc
+//
+//	@Summary		Deletes a comment
+//	@Description	Deletes a comment and its replies. Other users' comments can be removed by a moderator.
+//	@Tags			comments
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int	true	"Post ID"
+//	@Param			commentID	path		int	true	"Comment ID"
+//	@Success		204			{object}	string
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comment.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readCommentQuery reads and validates the pagination of a comment listing.
+func readCommentQuery(r *http.Request) (*store.PaginatedCommentQuery, error) {
+	cq := PaginatedCommentQueryAPi{
+		Limit: 20,
+		Order: "desc",
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		return nil, err
+	}
+
+	commentQuery := &store.PaginatedCommentQuery{
+		Limit: cq.Limit,
+		Order: cq.Order,
+	}
+
+	if cq.Cursor != "" {
+		cursor, err := store.DecodeCursor(cq.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		commentQuery.Cursor = cursor
+	}
+
+	return commentQuery, nil
+}
+
+// commentsContextMiddleware loads the comment in the URL. It has to run after
+// postsContextMiddleware: a comment of another post is reported as not found.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		comment, err := app.store.Comment.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if comment.PostID != getPostFromCtx(r).ID {
+			app.notFoundResponse(w, r, store.ErrorNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+func TestReadCommentQuery(t *testing.T) {
+	validCursor := store.Cursor{CreatedAt: time.Now(), ID: 1}.Encode()
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"should default the limit and order", "", false},
+		{"should accept a cursor", "?cursor=" + validCursor, false},
+		{"should accept ascending order", "?order=asc&limit=50", false},
+		{"should reject a non numeric limit", "?limit=ten", true},
+		{"should reject a limit over 50", "?limit=51", true},
+		{"should reject a zero limit", "?limit=0", true},
+		{"should reject an unknown order", "?order=sideways", true},
+		{"should reject an invalid cursor", "?cursor=garbage", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/posts/1/comments"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, err := readCommentQuery(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error; got %+v", q)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.query == "" && (q.Limit != 20 || q.Order != "desc" || q.Cursor != nil) {
+				t.Errorf("expected the defaults; got %+v", q)
+			}
+		})
+	}
+}
+
+func TestListComments(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		postID int64
+		query  string
+		want   int
+	}{
+		{"should list the comments of a post", 1, "", http.StatusOK},
+		{"should reject an invalid cursor", 1, "?cursor=garbage", http.StatusBadRequest},
+		{"should reject an unknown order", 1, "?order=sideways", http.StatusBadRequest},
+		{"should not find a missing post", store.MockMissingID, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "/v1/posts/" + strconv.FormatInt(tt.postID, 10) + "/comments" + tt.query
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestCommentOwnership(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	ownerToken := newTestToken(t, app, 42)
+	adminToken := newTestToken(t, app, store.MockAdminID)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		token  string
+		body   string
+		want   int
+	}{
+		{"should let the owner edit their comment", http.MethodPut, "/v1/posts/1/comments/1", ownerToken, `{"content": "edited"}`, http.StatusOK},
+		{"should not let others edit a comment", http.MethodPut, "/v1/posts/1/comments/2", ownerToken, `{"content": "edited"}`, http.StatusForbidden},
+		{"should let an admin edit any comment", http.MethodPut, "/v1/posts/1/comments/2", adminToken, `{"content": "edited"}`, http.StatusOK},
+		{"should reject an empty comment", http.MethodPut, "/v1/posts/1/comments/1", ownerToken, `{"content": ""}`, http.StatusBadRequest},
+		{"should let the owner delete their comment", http.MethodDelete, "/v1/posts/1/comments/1", ownerToken, "", http.StatusNoContent},
+		{"should not let others delete a comment", http.MethodDelete, "/v1/posts/1/comments/2", ownerToken, "", http.StatusForbidden},
+		{"should let a moderator delete any comment", http.MethodDelete, "/v1/posts/1/comments/2", adminToken, "", http.StatusNoContent},
+		{"should not find a missing comment", http.MethodDelete, "/v1/posts/1/comments/404", ownerToken, "", http.StatusNotFound},
+		{"should not find a comment of another post", http.MethodDelete, "/v1/posts/3/comments/1", ownerToken, "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestCommentReplies(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"should fetch a thread", http.MethodGet, "/v1/posts/1/comments/1", "", http.StatusOK},
+		{"should fetch a thread up to depth 5", http.MethodGet, "/v1/posts/1/comments/1?depth=5&limit=50", "", http.StatusOK},
+		{"should reject a thread deeper than 5", http.MethodGet, "/v1/posts/1/comments/1?depth=6", "", http.StatusBadRequest},
+		{"should reject a negative depth", http.MethodGet, "/v1/posts/1/comments/1?depth=-1", "", http.StatusBadRequest},
+		{"should reject a non numeric depth", http.MethodGet, "/v1/posts/1/comments/1?depth=deep", "", http.StatusBadRequest},
+		{"should not find a missing thread", http.MethodGet, "/v1/posts/1/comments/404", "", http.StatusNotFound},
+		{"should reply to a comment", http.MethodPost, "/v1/posts/1/comments/1/replies", `{"content": "a reply"}`, http.StatusCreated},
+		{"should reject an empty reply", http.MethodPost, "/v1/posts/1/comments/1/replies", `{"content": ""}`, http.StatusBadRequest},
+		{"should not reply to a comment of another post", http.MethodPost, "/v1/posts/3/comments/1/replies", `{"content": "a reply"}`, http.StatusNotFound},
+		{"should list the replies", http.MethodGet, "/v1/posts/1/comments/1/replies?order=asc", "", http.StatusOK},
+		{"should reject an invalid replies cursor", http.MethodGet, "/v1/posts/1/comments/1/replies?cursor=garbage", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
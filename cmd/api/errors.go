@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/Martins-Iroka/social/internal/policy"
+	"github.com/Martins-Iroka/social/internal/store"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -40,6 +44,27 @@ func (app *application) forbiddenErrorResponse(w http.ResponseWriter, r *http.Re
 	writeJSONError(w, http.StatusForbidden, "forbidden")
 }
 
+func (app *application) mfaRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	app.logger.Warnf("mfa required error", "method", r.Method, "path", r.URL.Path, "error", "")
+	writeJSONError(w, http.StatusForbidden, "two-factor authentication required")
+}
+
+// policyErrorResponse tells users who were denied only for a missing second
+// factor what to do about it.
+func (app *application) policyErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, policy.ErrMFARequired) {
+		app.mfaRequiredResponse(w, r)
+		return
+	}
+
+	app.forbiddenErrorResponse(w, r)
+}
+
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnf("service unavailable error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+}
+
 func (app *application) rateLimiteExceedResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
 	app.logger.Warnw("rate limit exceeded, retry after: "+retryAfter, "method", r.Method, "path", r.URL.Path)
 
@@ -47,3 +72,28 @@ func (app *application) rateLimiteExceedResponse(w http.ResponseWriter, r *http.
 
 	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
 }
+
+// storeErrorResponse maps the domain errors of the store to their response,
+// anything else is an internal error.
+func (app *application) storeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrorNotFound):
+		app.notFoundResponse(w, r, err)
+	case errors.Is(err, store.ErrorSelfFollow), errors.Is(err, store.ErrorMissingEmail):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, store.ErrorBlocked):
+		app.forbiddenErrorResponse(w, r)
+	case errors.Is(err, store.ErrorConflict),
+		errors.Is(err, store.ErrorUserFollowConflict),
+		errors.Is(err, store.ErrorUserUnFollowConflict),
+		errors.Is(err, store.ErrorDuplicateEmail),
+		errors.Is(err, store.ErrorDuplicateUsername),
+		errors.Is(err, store.ErrorDuplicateRole),
+		errors.Is(err, store.ErrorBuiltinRole):
+		app.conflictResponse(w, r, err)
+	case errors.Is(err, store.ErrorTOTPUnavailable):
+		app.serviceUnavailableResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
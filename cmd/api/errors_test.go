@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+func TestStoreErrorResponse(t *testing.T) {
+	app := newTestApplication(t, config{})
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{store.ErrorNotFound, http.StatusNotFound},
+		{store.ErrorSelfFollow, http.StatusBadRequest},
+		{store.ErrorMissingEmail, http.StatusBadRequest},
+		{store.ErrorBlocked, http.StatusForbidden},
+		{store.ErrorConflict, http.StatusConflict},
+		{store.ErrorUserFollowConflict, http.StatusConflict},
+		{store.ErrorUserUnFollowConflict, http.StatusConflict},
+		{store.ErrorDuplicateEmail, http.StatusConflict},
+		{store.ErrorDuplicateUsername, http.StatusConflict},
+		{store.ErrorDuplicateRole, http.StatusConflict},
+		{store.ErrorBuiltinRole, http.StatusConflict},
+		{store.ErrorTOTPUnavailable, http.StatusServiceUnavailable},
+		{fmt.Errorf("following: %w", store.ErrorBlocked), http.StatusForbidden},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rr := httptest.NewRecorder()
+
+			app.storeErrorResponse(rr, req, tt.err)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
@@ -9,24 +9,62 @@ import (
 // GetUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user feed. Pass next_cursor as cursor to get the next page. Top, hot and trending only rank the 500 newest matching posts.
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
+//	@Param			since	query		string	false	"Since (RFC 3339 or 2006-01-02 15:04:05)"
+//	@Param			until	query		string	false	"Until (RFC 3339 or 2006-01-02 15:04:05)"
 //	@Param			limit	query		int		false	"Limit"
-//	@Param			offset	query		int		false	"Offset"
-//	@Param			sort	query		string	false	"Sort"
-//	@Param			tags	query		string	false	"Tags"
-//	@Param			search	query		string	false	"Search"
+//	@Param			offset	query		int		false	"Offset, can't be combined with cursor"
+//	@Param			cursor	query		string	false	"Cursor, the next_cursor of the previous page"
+//	@Param			sort	query		string	false	"Sort (asc, desc, top, hot or trending)"
+//	@Param			tags	query		string	false	"Comma separated tags, posts must have all of them"
+//	@Param			search	query		string	false	"Search in title and content"
 //	@Success		200		{object}	[]store.PostWithMetadata
 //	@Failure		400		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feedQuery, err := readFeedQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user := getUserFromContext(r)
+
+	if app.config.redisCfg.enabled {
+		feed, next, ok, err := app.getTimelineFeed(ctx, user.ID, feedQuery)
+		if err != nil {
+			app.logger.Warnw("error reading timeline, falling back to the database", "user", user.ID, "error", err)
+		}
+
+		if err == nil && ok {
+			if err := jsonPaginatedResponse(w, http.StatusOK, feed, next); err != nil {
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	feed, next, err := app.store.Post.GetUserFeed(ctx, user.ID, feedQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
+	if err := jsonPaginatedResponse(w, http.StatusOK, feed, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readFeedQuery reads and validates the filters and pagination shared by every
+// post listing.
+func readFeedQuery(r *http.Request) (*store.PaginatedFeedQuery, error) {
 	fq := PaginatedFeedQueryAPi{
 		Limit:  20,
 		Offset: 0,
@@ -35,13 +73,11 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	fq, err := fq.Parse(r)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		return nil, err
 	}
 
 	if err := Validate.Struct(fq); err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		return nil, err
 	}
 
 	feedQuery := &store.PaginatedFeedQuery{
@@ -54,15 +90,20 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Until:  fq.Until,
 	}
 
-	ctx := r.Context()
-
-	feed, err := app.store.Post.GetUserFeed(ctx, int64(1), feedQuery)
-	if err != nil {
-		app.internalServerError(w, r, err)
-		return
+	// the ranked sorts resume at an offset into the ranking, the others at a keyset
+	if fq.Cursor != "" && store.IsRankedSort(fq.Sort) {
+		cursor, err := store.DecodeOffsetCursor(fq.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		feedQuery.Offset = cursor.Offset
+	} else if fq.Cursor != "" {
+		cursor, err := store.DecodeCursor(fq.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		feedQuery.Cursor = cursor
 	}
 
-	if err := jsonResponse(w, http.StatusOK, feed); err != nil {
-		app.internalServerError(w, r, err)
-	}
+	return feedQuery, nil
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+func TestGetUserFeed(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor := store.Cursor{CreatedAt: time.Now(), ID: 1}.Encode()
+	offsetCursor := store.OffsetCursor{Offset: 20}.Encode()
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"should return the first page", "", http.StatusOK},
+		{"should page with an offset", "?offset=20", http.StatusOK},
+		{"should page with a cursor", "?cursor=" + cursor, http.StatusOK},
+		{"should page with a cursor in ascending order", "?sort=asc&cursor=" + cursor, http.StatusOK},
+		{"should reject an invalid cursor", "?cursor=garbage", http.StatusBadRequest},
+		{"should reject a cursor with an offset", "?offset=20&cursor=" + cursor, http.StatusBadRequest},
+		{"should reject a keyset cursor with a ranked sort", "?sort=top&cursor=" + cursor, http.StatusBadRequest},
+		{"should page a ranked sort with an offset cursor", "?sort=hot&cursor=" + offsetCursor, http.StatusOK},
+		{"should reject an offset cursor with the latest posts", "?cursor=" + offsetCursor, http.StatusBadRequest},
+		{"should reject an offset cursor with an offset", "?sort=top&offset=20&cursor=" + offsetCursor, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/feed"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type PrivacyPayload struct {
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// SetPrivacy godoc
+//
+//	@summary		Makes the caller's account private or public
+//	@description	The posts of a private account are only readable by its approved followers. Going public approves every pending follow request.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		PrivacyPayload	true	"Privacy"
+//	@success		204		{string}	string			"Privacy updated"
+//	@failure		400		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/privacy	[put]
+func (app *application) setPrivacyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload PrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	approved, err := app.store.User.SetPrivate(ctx, user.ID, *payload.IsPrivate)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUser(ctx, user.ID)
+
+	for _, followerID := range approved {
+		app.invalidateTimeline(ctx, followerID)
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ListFollowRequests godoc
+//
+//	@summary		Lists the pending requests to follow the caller
+//	@description	Lists the pending follow requests newest first. Pass next_cursor as cursor to get the next page.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			limit	query		int		false	"Limit"
+//	@param			cursor	query		string	false	"Cursor"
+//	@success		200		{object}	[]store.Connection
+//	@failure		400		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/follow-requests	[get]
+func (app *application) listFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	followQuery, err := readFollowQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	requests, next, err := app.store.User.ListFollowRequests(r.Context(), user.ID, followQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonPaginatedResponse(w, http.StatusOK, requests, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ApproveFollowRequest godoc
+//
+//	@summary		Approves a follow request
+//	@description	Approves the request of the user in the URL to follow the caller
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"Requester ID"
+//	@success		204		{string}	string	"Follow request approved"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"Follow request not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/follow-requests/{userID}/approve	[put]
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, func(ctx context.Context, userID, followerID int64) error {
+		if err := app.store.User.ApproveFollowRequest(ctx, userID, followerID); err != nil {
+			return err
+		}
+
+		// the requester now follows the caller
+		app.invalidateTimeline(ctx, followerID)
+		return nil
+	})
+}
+
+// DenyFollowRequest godoc
+//
+//	@summary		Denies a follow request
+//	@description	Denies the request of the user in the URL to follow the caller
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"Requester ID"
+//	@success		204		{string}	string	"Follow request denied"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"Follow request not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/follow-requests/{userID}/deny	[put]
+func (app *application) denyFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.User.DenyFollowRequest)
+}
+
+// answerFollowRequest approves or denies the request of the user in the URL
+// to follow the caller.
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer func(ctx context.Context, userID, followerID int64) error) {
+	followerID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := answer(r.Context(), user.ID, followerID); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
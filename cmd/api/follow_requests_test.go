@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPrivateAccounts(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"should make the account private", http.MethodPut, "/v1/users/privacy", `{"is_private": true}`, http.StatusNoContent},
+		{"should make the account public", http.MethodPut, "/v1/users/privacy", `{"is_private": false}`, http.StatusNoContent},
+		{"should require the privacy", http.MethodPut, "/v1/users/privacy", `{}`, http.StatusBadRequest},
+		{"should only request to follow a private account", http.MethodPut, "/v1/users/11/follow", `{"user_id": 11}`, http.StatusAccepted},
+		{"should hide the posts of a private account", http.MethodGet, "/v1/posts/11", "", http.StatusNotFound},
+		{"should list the follow requests", http.MethodGet, "/v1/users/follow-requests?limit=10", "", http.StatusOK},
+		{"should reject an invalid follow requests cursor", http.MethodGet, "/v1/users/follow-requests?cursor=garbage", "", http.StatusBadRequest},
+		{"should approve a follow request", http.MethodPut, "/v1/users/follow-requests/7/approve", "", http.StatusNoContent},
+		{"should deny a follow request", http.MethodPut, "/v1/users/follow-requests/7/deny", "", http.StatusNoContent},
+		{"should not approve a missing follow request", http.MethodPut, "/v1/users/follow-requests/404/approve", "", http.StatusNotFound},
+		{"should not deny a missing follow request", http.MethodPut, "/v1/users/follow-requests/404/deny", "", http.StatusNotFound},
+		{"should reject an invalid requester id", http.MethodPut, "/v1/users/follow-requests/seven/approve", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+
+	t.Run("should let the owner read their private posts", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/11", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+newTestToken(t, app, 11))
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
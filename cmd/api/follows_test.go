@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+func TestReadFollowQuery(t *testing.T) {
+	cursor := store.Cursor{CreatedAt: time.Now(), ID: 3}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantLimit  int
+		wantCursor bool
+		wantErr    bool
+	}{
+		{"should default the limit", "", 20, false, false},
+		{"should read the limit", "?limit=50", 50, false, false},
+		{"should read the cursor", "?cursor=" + cursor.Encode(), 20, true, false},
+		{"should reject a non numeric limit", "?limit=all", 0, false, true},
+		{"should reject a zero limit", "?limit=0", 0, false, true},
+		{"should reject a limit over 50", "?limit=51", 0, false, true},
+		{"should reject an invalid cursor", "?cursor=garbage", 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/7/followers"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, err := readFollowQuery(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error; got %+v", q)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if q.Limit != tt.wantLimit || (q.Cursor != nil) != tt.wantCursor {
+				t.Errorf("expected limit %d and cursor %v; got %+v", tt.wantLimit, tt.wantCursor, q)
+			}
+
+			if tt.wantCursor && q.Cursor.ID != cursor.ID {
+				t.Errorf("expected cursor id %d; got %d", cursor.ID, q.Cursor.ID)
+			}
+		})
+	}
+}
+
+func TestListConnections(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"should list the followers", "/v1/users/7/followers", http.StatusOK},
+		{"should list the following", "/v1/users/7/following?limit=5", http.StatusOK},
+		{"should reject an invalid cursor", "/v1/users/7/followers?cursor=garbage", http.StatusBadRequest},
+		{"should reject an invalid user id", "/v1/users/seven/following", http.StatusBadRequest},
+		{"should not find the followers of a missing user", "/v1/users/404/followers", http.StatusNotFound},
+		{"should not find the following of a missing user", "/v1/users/404/following", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+
+	t.Run("should include the follow counts in profiles", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/7", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data map[string]any `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{"followers_count", "following_count"} {
+			if _, ok := res.Data[key]; !ok {
+				t.Errorf("expected %s in %v", key, res.Data)
+			}
+		}
+	})
+}
+
+func TestFollowUser(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"should follow a user", http.MethodPut, "/v1/users/7/follow", `{"user_id": 7}`, http.StatusNoContent},
+		{"should request to follow a private account", http.MethodPut, "/v1/users/11/follow", `{"user_id": 11}`, http.StatusAccepted},
+		{"should not follow yourself", http.MethodPut, "/v1/users/42/follow", `{"user_id": 42}`, http.StatusBadRequest},
+		{"should not follow a user who blocked you", http.MethodPut, "/v1/users/13/follow", `{"user_id": 13}`, http.StatusForbidden},
+		{"should not follow a missing user", http.MethodPut, "/v1/users/404/follow", `{"user_id": 404}`, http.StatusNotFound},
+		{"should reject an invalid payload", http.MethodPut, "/v1/users/7/follow", `{"user_id": "seven"}`, http.StatusBadRequest},
+		{"should unfollow a user", http.MethodPut, "/v1/users/7/unfollow", `{"user_id": 7}`, http.StatusNoContent},
+		{"should not unfollow a user you don't follow", http.MethodPut, "/v1/users/404/unfollow", `{"user_id": 404}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestFollowSuggestions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"should suggest users", "", http.StatusOK},
+		{"should read the limit", "?limit=50", http.StatusOK},
+		{"should reject a limit over 50", "?limit=51", http.StatusBadRequest},
+		{"should reject a non numeric limit", "?limit=all", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/suggestions"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
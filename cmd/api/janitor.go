@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runJanitor periodically cleans up the rows nobody is going to use anymore:
+// expired invitations, the accounts that were never activated, abandoned
+// OIDC logins and the refresh tokens and revoked jtis past their expiry.
+func (app *application) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(app.config.janitor.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.cleanup(ctx)
+		}
+	}
+}
+
+func (app *application) cleanup(ctx context.Context) {
+	users, err := app.store.User.DeleteInactiveUsers(ctx, app.config.janitor.gracePeriod)
+	if err != nil {
+		app.logger.Errorw("error deleting inactive users", "error", err)
+	}
+
+	invitations, err := app.store.User.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		app.logger.Errorw("error deleting expired invitations", "error", err)
+	}
+
+	loginStates, err := app.store.Identities.DeleteExpiredLoginStates(ctx)
+	if err != nil {
+		app.logger.Errorw("error deleting expired login states", "error", err)
+	}
+
+	refreshTokens, err := app.store.RefreshTokens.DeleteExpired(ctx)
+	if err != nil {
+		app.logger.Errorw("error deleting expired refresh tokens", "error", err)
+	}
+
+	revokedTokens, err := app.store.Revocations.DeleteExpired(ctx)
+	if err != nil {
+		app.logger.Errorw("error deleting expired revoked tokens", "error", err)
+	}
+
+	app.logger.Infow("janitor finished",
+		"invitations", invitations,
+		"users", users,
+		"login_states", loginStates,
+		"refresh_tokens", refreshTokens,
+		"revoked_tokens", revokedTokens,
+	)
+}
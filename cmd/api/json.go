@@ -46,3 +46,14 @@ func jsonResponse(w http.ResponseWriter, status int, data any) error {
 
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// jsonPaginatedResponse is jsonResponse for a page of a keyset paginated list,
+// nextCursor is left out on the last page.
+func jsonPaginatedResponse(w http.ResponseWriter, status int, data any, nextCursor string) error {
+	type envelope struct {
+		Data       any    `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, NextCursor: nextCursor})
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"encoding/base64"
+	"errors"
 	"expvar"
+	"fmt"
+	"net/http"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/Martins-Iroka/social/internal/auth"
@@ -12,6 +17,7 @@ import (
 	"github.com/Martins-Iroka/social/internal/ratelimiter"
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/Martins-Iroka/social/internal/store/cache"
+	"github.com/Martins-Iroka/social/internal/totp"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
@@ -52,16 +58,33 @@ func main() {
 			db:      env.GetInt("REDIS_DB", 0),
 			enabled: env.GetBool("REDIS_ENABLED", false),
 		},
+		timeline: timelineConfig{
+			maxLen:             env.GetInt("TIMELINE_MAX_LEN", 800),
+			celebrityThreshold: env.GetInt("TIMELINE_CELEBRITY_THRESHOLD", 10000),
+			ttl:                env.GetDuration("TIMELINE_TTL", time.Hour*24),
+		},
 		env: env.GetString("ENV", "development"),
 		mail: mailConfig{
-			expiry:    time.Hour * 24 * 3, // 3 days
-			fromEmail: env.GetString("FROM_EMAIL", ""),
+			expiry:              time.Hour * 24 * 3, // 3 days
+			passwordResetExpiry: time.Minute * 30,
+			fromEmail:           env.GetString("FROM_EMAIL", ""),
+			provider:            env.GetString("MAILER", "sendgrid"),
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
 			},
 			mailTrap: mailTrapConfig{
 				apiKey: env.GetString("MAILTRAP_API_KEY", ""),
 			},
+			smtp: mailer.SMTPConfig{
+				Host:     env.GetString("SMTP_HOST", ""),
+				Port:     env.GetInt("SMTP_PORT", 587),
+				Username: env.GetString("SMTP_USERNAME", ""),
+				Password: env.GetString("SMTP_PASSWORD", ""),
+				Security: env.GetString("SMTP_SECURITY", mailer.SMTPSecurityStartTLS),
+				Auth:     env.GetString("SMTP_AUTH", ""),
+			},
+			// empty logs the emails instead of writing them to files
+			devDir: env.GetString("DEV_MAILER_DIR", ""),
 		},
 		auth: authConfig{
 			basic: basicConfig{
@@ -69,21 +92,56 @@ func main() {
 				pass: env.GetString("AUTH_BASIC_PASS", "admin"),
 			},
 			token: tokenConfig{
-				secret: env.GetString("AUTH_TOKEN_SECRET", "test"),
-				exp:    time.Hour * 24 * 3, // 3 days
-				iss:    "gophersocial",
+				secret:       env.GetString("AUTH_TOKEN_SECRET", ""),
+				exp:          time.Minute * 15,
+				refreshExp:   time.Hour * 24 * 30, // 30 days
+				mfaExp:       time.Minute * 5,
+				iss:          "gophersocial",
+				keyFile:      env.GetString("AUTH_TOKEN_KEY_FILE", ""),
+				keyID:        env.GetString("AUTH_TOKEN_KEY_ID", ""),
+				previousKeys: env.GetString("AUTH_TOKEN_PREVIOUS_KEYS", ""),
 			},
+			oidc: oidcConfig{
+				providers: oidcProvidersFromEnv(env.GetString("OIDC_PROVIDERS", "")),
+				stateExp:  time.Minute * 10,
+			},
+			totpKey: env.GetString("TOTP_SECRET_KEY", ""), // optional, TOTP is disabled without it
 		},
 		rateLimiter: ratelimiter.Config{
 			RequestsPerTimeFrame: env.GetInt("RATELIMITER_REQUESTS_COUNT", 20),
 			TimeFrame:            time.Second * 5,
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
 		},
+		emailRateLimiter: ratelimiter.Config{
+			RequestsPerTimeFrame: env.GetInt("EMAIL_RATELIMITER_REQUESTS_COUNT", 3),
+			TimeFrame:            time.Hour,
+			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
+			MaxKeys:              env.GetInt("EMAIL_RATELIMITER_MAX_KEYS", 10000),
+		},
+		janitor: janitorConfig{
+			enabled:     env.GetBool("JANITOR_ENABLED", true),
+			interval:    env.GetDuration("JANITOR_INTERVAL", time.Hour),
+			gracePeriod: env.GetDuration("INACTIVE_USER_GRACE_PERIOD", time.Hour*24*7), // 7 days
+		},
+		outbox: outboxConfig{
+			enabled:      env.GetBool("OUTBOX_ENABLED", true),
+			workers:      env.GetInt("OUTBOX_WORKERS", 2),
+			batchSize:    env.GetInt("OUTBOX_BATCH_SIZE", 10),
+			pollInterval: env.GetDuration("OUTBOX_POLL_INTERVAL", time.Second*5),
+			lease:        time.Minute * 5,
+			maxAttempts:  env.GetInt("OUTBOX_MAX_ATTEMPTS", 8),
+			backoff:      time.Second * 30,
+			maxBackoff:   time.Hour,
+		},
 	}
 
 	logger := zap.Must(zap.NewProduction()).Sugar()
 	defer logger.Sync()
 
+	if cfg.janitor.enabled && cfg.janitor.interval <= 0 {
+		logger.Fatalw("JANITOR_INTERVAL must be positive", "interval", cfg.janitor.interval)
+	}
+
 	db, err := db.New(
 		cfg.db.addr,
 		cfg.db.maxOpenConns,
@@ -114,18 +172,32 @@ func main() {
 		cfg.rateLimiter.TimeFrame,
 	)
 
-	store := store.NewPostgresStorage(db)
-	// Sendgrid
-	mailer := mailer.NewSendgrid(cfg.mail.sendGrid.apiKey, cfg.mail.fromEmail)
+	// the keys come from the request body, so their number has to be bounded
+	emailRateLimiter := ratelimiter.NewBoundedFixedWindowLimiter(
+		cfg.emailRateLimiter.RequestsPerTimeFrame,
+		cfg.emailRateLimiter.TimeFrame,
+		cfg.emailRateLimiter.MaxKeys,
+	)
+
+	totpSecrets, err := newTOTPSecretBox(cfg.auth.totpKey)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if totpSecrets == nil {
+		logger.Warn("TOTP_SECRET_KEY isn't set, two-factor authentication with TOTP is disabled")
+	}
 
-	// Mailtrap
-	// mailer, err := mailer.NewMailTrapClient(cfg.mail.mailTrap.apiKey, cfg.mail.fromEmail)
+	store := store.NewPostgresStorage(db, totpSecrets)
+	mailer, err := newMailer(cfg.mail)
 	if err != nil {
 		logger.Fatal(err)
 	}
+	logger.Infow("mailer configured", "provider", cfg.mail.provider)
 
-	tokenHost := cfg.auth.token.iss
-	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, tokenHost, tokenHost)
+	jwtAuthenticator, err := newAuthenticator(cfg.auth.token)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	app := &application{
 		config:        cfg,
@@ -135,6 +207,9 @@ func main() {
 		authenticator: jwtAuthenticator,
 		cacheStorage:  redisStore,
 		ratelimiter:   rateLimiter,
+
+		emailRateLimiter: emailRateLimiter,
+		oidcProviders:    newOIDCProviders(cfg.auth.oidc),
 	}
 
 	expvar.NewString("version").Set(version)
@@ -151,3 +226,124 @@ func main() {
 
 	logger.Fatal(app.run(mux))
 }
+
+func newMailer(cfg mailConfig) (mailer.Client, error) {
+	switch cfg.provider {
+	case "sendgrid":
+		return mailer.NewSendgrid(cfg.sendGrid.apiKey, cfg.fromEmail), nil
+	case "mailtrap":
+		return mailer.NewMailTrapClient(cfg.mailTrap.apiKey, cfg.fromEmail)
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.smtp, cfg.fromEmail)
+	case "dev":
+		return mailer.NewDevMailer(cfg.devDir, cfg.fromEmail)
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.provider)
+	}
+}
+
+// minTokenSecretLen is the shortest AUTH_TOKEN_SECRET accepted, 256 bits for HS256.
+const minTokenSecretLen = 32
+
+func newAuthenticator(cfg tokenConfig) (*auth.JWTAuthenticator, error) {
+	tokenHost := cfg.iss
+
+	var signing *auth.Key
+	switch {
+	case cfg.keyFile != "":
+		// the kid is how the key is told apart from the next one once it's rotated
+		if cfg.keyID == "" {
+			return nil, errors.New("AUTH_TOKEN_KEY_ID is required with AUTH_TOKEN_KEY_FILE")
+		}
+
+		key, err := auth.LoadKey(cfg.keyID, cfg.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		signing = key
+	case len(cfg.secret) >= minTokenSecretLen:
+		signing = auth.NewHMACKey(cfg.keyID, cfg.secret)
+	default:
+		return nil, fmt.Errorf("AUTH_TOKEN_KEY_FILE or an AUTH_TOKEN_SECRET of at least %d characters is required", minTokenSecretLen)
+	}
+
+	var previous []*auth.Key
+	for _, pair := range strings.Split(cfg.previousKeys, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, path, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("previous key %q: expected kid=path or kid=hmac", pair)
+		}
+
+		// the HS256 secret the tokens were signed with before moving to a key file
+		if path == "hmac" {
+			if len(cfg.secret) < minTokenSecretLen {
+				return nil, fmt.Errorf("previous key %q: AUTH_TOKEN_SECRET of at least %d characters is required", pair, minTokenSecretLen)
+			}
+			previous = append(previous, auth.NewHMACKey(id, cfg.secret))
+			continue
+		}
+
+		key, err := auth.LoadKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+
+	return auth.NewJWTAuthenticator(tokenHost, tokenHost, signing, previous...)
+}
+
+// newTOTPSecretBox takes the key as base64, e.g. the output of
+// `openssl rand -base64 32`. Without a key there's no box and TOTP is off.
+func newTOTPSecretBox(key string) (*totp.SecretBox, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("TOTP_SECRET_KEY: %w", err)
+	}
+
+	return totp.NewSecretBox(raw)
+}
+
+// oidcProvidersFromEnv reads the OIDC_<NAME>_* variables of each provider in
+// names, comma separated.
+func oidcProvidersFromEnv(names string) map[string]auth.OIDCConfig {
+	providers := map[string]auth.OIDCConfig{}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers[name] = auth.OIDCConfig{
+			Issuer:       env.GetString(prefix+"ISSUER", ""),
+			ClientID:     env.GetString(prefix+"CLIENT_ID", ""),
+			ClientSecret: env.GetString(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  env.GetString(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(env.GetString(prefix+"SCOPES", "openid email profile")),
+		}
+	}
+
+	return providers
+}
+
+func newOIDCProviders(cfg oidcConfig) map[string]*auth.OIDCProvider {
+	client := &http.Client{Timeout: time.Second * 10}
+
+	providers := map[string]*auth.OIDCProvider{}
+	for name, providerCfg := range cfg.providers {
+		providers[name] = auth.NewOIDCProvider(name, providerCfg, client)
+	}
+
+	return providers
+}
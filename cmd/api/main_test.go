@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/totp"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := strings.Repeat("s", minTokenSecretLen)
+
+	tests := []struct {
+		name    string
+		cfg     tokenConfig
+		wantErr bool
+	}{
+		{"should sign with a secret", tokenConfig{secret: secret}, false},
+		{"should sign with a key file", tokenConfig{keyFile: keyFile, keyID: "2024-05"}, false},
+		{"should keep the secret as a previous key", tokenConfig{secret: secret, keyFile: keyFile, keyID: "2024-05", previousKeys: "=hmac"}, false},
+		{"should require a secret or a key file", tokenConfig{}, true},
+		{"should reject a short secret", tokenConfig{secret: "test"}, true},
+		{"should require a key id with a key file", tokenConfig{keyFile: keyFile}, true},
+		{"should require the secret of a previous hmac key", tokenConfig{keyFile: keyFile, keyID: "2024-05", previousKeys: "old=hmac"}, true},
+		{"should reject a malformed previous key", tokenConfig{secret: secret, previousKeys: "old"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newAuthenticator(tt.cfg)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v; got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("should validate the tokens of the secret after moving to a key file", func(t *testing.T) {
+		cfg := tokenConfig{secret: secret, iss: "test"}
+
+		before, err := newAuthenticator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := before.GenerateToken(jwt.MapClaims{
+			"sub": 42,
+			"aud": "test",
+			"iss": "test",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg.keyFile, cfg.keyID, cfg.previousKeys = keyFile, "2024-05", "=hmac"
+
+		after, err := newAuthenticator(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := after.ValidateToken(token); err != nil {
+			t.Errorf("expected the token to be valid; got %v", err)
+		}
+	})
+}
+
+func TestNewTOTPSecretBox(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantBox bool
+		wantErr bool
+	}{
+		{"should accept a base64 key", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", totp.KeySize))), true, false},
+		{"should disable totp without a key", "", false, false},
+		{"should reject a key that isn't base64", "not base64!", false, true},
+		{"should reject a short key", base64.StdEncoding.EncodeToString([]byte("short")), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box, err := newTOTPSecretBox(tt.key)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v; got %v", tt.wantErr, err)
+			}
+			if tt.wantBox != (box != nil) {
+				t.Errorf("expected a box %v; got %v", tt.wantBox, box)
+			}
+		})
+	}
+}
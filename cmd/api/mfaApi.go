@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/Martins-Iroka/social/internal/totp"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// The authentication methods (RFC 8176) a session went through, kept in the
+// amr claim of its access tokens.
+const (
+	amrPassword  = "pwd"
+	amrFederated = "fed"
+	amrOTP       = "otp"
+	amrMFA       = "mfa"
+)
+
+// mfaTokenType is the typ claim of the challenge tokens, which can't
+// authenticate requests.
+const mfaTokenType = "mfa"
+
+const recoveryCodeCount = 10
+
+var (
+	errInvalidMFACode = errors.New("invalid two-factor authentication code")
+	errMFANotEnabled  = errors.New("two-factor authentication isn't enabled")
+)
+
+type MFAChallenge struct {
+	MFAToken  string `json:"mfa_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// issueTokens logs the user in with a new token pair, or challenges them for
+// their second factor if they enabled it. amr are the methods the user
+// authenticated with so far.
+func (app *application) issueTokens(w http.ResponseWriter, r *http.Request, user *store.User, amr []string) {
+	if !user.MFAEnabled {
+		tokens, err := app.createTokenPair(r.Context(), user.ID, amr)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := jsonResponse(w, http.StatusCreated, tokens); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"exp": time.Now().Add(app.config.auth.token.mfaExp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.iss,
+		"jti": uuid.New().String(),
+		"typ": mfaTokenType,
+		"amr": amr,
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	challenge := MFAChallenge{
+		MFAToken:  token,
+		ExpiresIn: int64(app.config.auth.token.mfaExp.Seconds()),
+	}
+
+	if err := jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type VerifyMFAPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// Code is the code of the authenticator app, RecoveryCode one of the
+	// recovery codes for a lost device
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=64"`
+}
+
+// VerifyMFA godoc
+//
+//	@summary		Completes a login with the second factor
+//	@description	Exchanges the MFA challenge of a login and a TOTP code, or a recovery code, for an access token and a refresh token. A challenge can only be tried once.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		VerifyMFAPayload	true	"Challenge and code"
+//	@success		201		{object}	TokenPair			"Tokens"
+//	@failure		400		{object}	error
+//	@failure		401		{object}	error
+//	@failure		500		{object}	error
+//	@failure		503		{object}	error	"TOTP isn't configured"
+//	@router			/authentication/mfa [post]
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	claims := jwtToken.Claims.(jwt.MapClaims)
+	if typ, _ := claims["typ"].(string); typ != mfaTokenType {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("not an mfa token"))
+		return
+	}
+
+	userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has no expiration"))
+		return
+	}
+
+	ctx := r.Context()
+
+	revoked, err := app.isTokenRevoked(ctx, claims, userID)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	if revoked {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has been revoked"))
+		return
+	}
+
+	// one guess per challenge, whether it's right or wrong
+	if err := app.revokeToken(ctx, claims, userID, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the user could have been deactivated since the challenge was issued
+	if _, err := app.store.User.GetUserByID(ctx, userID); err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	amr := amrFromClaims(claims)
+	if payload.Code != "" {
+		err = app.useTOTP(ctx, userID, payload.Code)
+		amr = append(amr, amrOTP, amrMFA)
+	} else {
+		err = app.store.MFA.UseRecoveryCode(ctx, userID, totp.NormalizeRecoveryCode(payload.RecoveryCode))
+		amr = append(amr, amrMFA)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidMFACode), errors.Is(err, errMFANotEnabled), errors.Is(err, store.ErrorNotFound):
+			app.unauthorizedErrorResponse(w, r, err)
+		case errors.Is(err, store.ErrorTOTPUnavailable):
+			app.serviceUnavailableResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.createTokenPair(ctx, userID, amr)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code
+	URI string `json:"uri"`
+}
+
+type EnrollTOTPPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+// EnrollTOTP godoc
+//
+//	@summary		Starts a TOTP enrollment
+//	@description	Generates the secret of an authenticator app. The password of the user is asked again so a stolen access token can't enroll an app of its own. Two-factor authentication is only enabled once a code of the app is confirmed.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		EnrollTOTPPayload	true	"Password of the user"
+//	@success		201		{object}	TOTPEnrollment
+//	@failure		400		{object}	error
+//	@failure		401		{object}	error	"Wrong password"
+//	@failure		409		{object}	error	"Already enabled"
+//	@failure		500		{object}	error
+//	@failure		503		{object}	error	"TOTP isn't configured"
+//	@security		ApiKeyAuth
+//	@router			/authentication/mfa/totp [post]
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload EnrollTOTPPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	// the user of the context can come from the cache, which has no password
+	account, err := app.store.User.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := account.Password.ComparePassword(payload.Password); err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.SetPendingTOTP(ctx, user.ID, secret); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	enrollment := TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(app.config.auth.token.iss, user.Email, secret),
+	}
+
+	if err := jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type RecoveryCodes struct {
+	// RecoveryCodes are only shown once, each of them can be used once
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// ConfirmTOTP godoc
+//
+//	@summary		Enables TOTP two-factor authentication
+//	@description	Confirms the enrollment with a code of the authenticator app and returns the recovery codes.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		TOTPCodePayload	true	"Code of the app"
+//	@success		200		{object}	RecoveryCodes
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error	"No enrollment"
+//	@failure		409		{object}	error	"Already enabled"
+//	@failure		500		{object}	error
+//	@failure		503		{object}	error	"TOTP isn't configured"
+//	@security		ApiKeyAuth
+//	@router			/authentication/mfa/totp [put]
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	t, err := app.store.MFA.GetTOTP(ctx, user.ID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if t.Enabled {
+		app.conflictResponse(w, r, store.ErrorConflict)
+		return
+	}
+
+	counter, ok := totp.Validate(t.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, errInvalidMFACode)
+		return
+	}
+
+	codes, err := totp.RecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.EnableTOTP(ctx, user.ID, counter, normalizeRecoveryCodes(codes)); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	app.invalidateUser(ctx, user.ID)
+
+	if err := jsonResponse(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// DisableTOTP godoc
+//
+//	@summary		Disables TOTP two-factor authentication
+//	@description	Takes a current code of the authenticator app. The recovery codes are deleted as well.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		TOTPCodePayload	true	"Code of the app"
+//	@success		204		{string}	string			"Disabled"
+//	@failure		400		{object}	error
+//	@failure		500		{object}	error
+//	@failure		503		{object}	error	"TOTP isn't configured"
+//	@security		ApiKeyAuth
+//	@router			/authentication/mfa/totp [delete]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.useTOTP(ctx, user.ID, payload.Code); err != nil {
+		app.mfaCodeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.DisableTOTP(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUser(ctx, user.ID)
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RegenerateRecoveryCodes godoc
+//
+//	@summary		Regenerates the recovery codes
+//	@description	Takes a current code of the authenticator app. The previous recovery codes stop working.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		TOTPCodePayload	true	"Code of the app"
+//	@success		200		{object}	RecoveryCodes
+//	@failure		400		{object}	error
+//	@failure		500		{object}	error
+//	@failure		503		{object}	error	"TOTP isn't configured"
+//	@security		ApiKeyAuth
+//	@router			/authentication/mfa/recovery-codes [post]
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.useTOTP(ctx, user.ID, payload.Code); err != nil {
+		app.mfaCodeErrorResponse(w, r, err)
+		return
+	}
+
+	codes, err := totp.RecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.ReplaceRecoveryCodes(ctx, user.ID, normalizeRecoveryCodes(codes)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, RecoveryCodes{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// useTOTP accepts a code of the user's authenticator app once.
+func (app *application) useTOTP(ctx context.Context, userID int64, code string) error {
+	t, err := app.store.MFA.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrorNotFound) {
+			return errMFANotEnabled
+		}
+		return err
+	}
+
+	if !t.Enabled {
+		return errMFANotEnabled
+	}
+
+	counter, ok := totp.Validate(t.Secret, code, time.Now())
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	// a code that was already used, e.g. by someone looking over a shoulder
+	if err := app.store.MFA.UseTOTPCounter(ctx, userID, counter); err != nil {
+		if errors.Is(err, store.ErrorConflict) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (app *application) mfaCodeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errInvalidMFACode), errors.Is(err, errMFANotEnabled):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, store.ErrorTOTPUnavailable):
+		app.serviceUnavailableResponse(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// normalizeRecoveryCodes is what the store keeps the hashes of, so the codes
+// can be typed back in any format.
+func normalizeRecoveryCodes(codes []string) []string {
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = totp.NormalizeRecoveryCode(code)
+	}
+	return normalized
+}
+
+// amrFromClaims returns a copy of the amr claim.
+func amrFromClaims(claims jwt.MapClaims) []string {
+	amr := []string{}
+
+	values, _ := claims["amr"].([]any)
+	for _, v := range values {
+		if method, ok := v.(string); ok {
+			amr = append(amr, method)
+		}
+	}
+
+	return amr
+}
+
+func hasAMR(claims jwt.MapClaims, method string) bool {
+	for _, m := range amrFromClaims(claims) {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/Martins-Iroka/social/internal/totp"
+)
+
+func TestVerifyMFA(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	accessToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should only accept mfa challenge tokens", func(t *testing.T) {
+		body := strings.NewReader(`{"mfa_token": "` + accessToken + `", "code": "123456"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should require a code or a recovery code", func(t *testing.T) {
+		body := strings.NewReader(`{"mfa_token": "` + accessToken + `"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+// unconfiguredMFAStore is the MFA store of an api started without TOTP_SECRET_KEY.
+type unconfiguredMFAStore struct {
+	store.MockMFAStore
+}
+
+func (s *unconfiguredMFAStore) SetPendingTOTP(ctx context.Context, userID int64, secret string) error {
+	return store.ErrorTOTPUnavailable
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa/totp", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should require the password", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa/totp", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should reject a wrong password", func(t *testing.T) {
+		body := strings.NewReader(`{"password": "wrong-password"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa/totp", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should return the secret and the otpauth uri", func(t *testing.T) {
+		body := strings.NewReader(`{"password": "` + store.MockPassword + `"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa/totp", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var res struct {
+			Data TOTPEnrollment `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Data.Secret == "" || !strings.HasPrefix(res.Data.URI, "otpauth://totp/") {
+			t.Errorf("expected a secret and an otpauth uri; got %+v", res.Data)
+		}
+	})
+
+	t.Run("should refuse to enroll when totp isn't configured", func(t *testing.T) {
+		app := newTestApplication(t, config{})
+		app.store.MFA = &unconfiguredMFAStore{}
+		mux := app.mount()
+
+		body := strings.NewReader(`{"password": "` + store.MockPassword + `"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/mfa/totp", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("should return the recovery codes once confirmed", func(t *testing.T) {
+		code, err := totp.Code(store.MockTOTPSecret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := strings.NewReader(`{"code": "` + code + `"}`)
+		req, err := http.NewRequest(http.MethodPut, "/v1/authentication/mfa/totp", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data RecoveryCodes `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Data.RecoveryCodes) != recoveryCodeCount {
+			t.Errorf("expected %d recovery codes; got %d", recoveryCodeCount, len(res.Data.RecoveryCodes))
+		}
+	})
+
+	t.Run("should not disable two-factor authentication that isn't enabled", func(t *testing.T) {
+		body := strings.NewReader(`{"code": "123456"}`)
+		req, err := http.NewRequest(http.MethodDelete, "/v1/authentication/mfa/totp", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Martins-Iroka/social/internal/policy"
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -76,6 +78,13 @@ func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		claims := jwtToken.Claims.(jwt.MapClaims)
+
+		// challenge tokens of the login flow are only good for finishing it
+		if typ, _ := claims["typ"].(string); typ != "" {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("%s token can't authenticate requests", typ))
+			return
+		}
+
 		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
@@ -83,6 +92,18 @@ func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx := r.Context()
+
+		// check the token hasn't been revoked (logout, revoke all sessions)
+		revoked, err := app.isTokenRevoked(ctx, claims, userID)
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+
+		if revoked {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has been revoked"))
+			return
+		}
 		user, err := app.getUser(ctx, userID)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
@@ -90,30 +111,33 @@ func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx = context.WithValue(ctx, userContextKey, user)
+		ctx = context.WithValue(ctx, claimsContextKey, claims)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+func (app *application) checkPostOwnership(perm policy.Permission, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := getUserFromContext(r)
 		post := getPostFromCtx(r)
-		// check if it is the user's post
-		if post.UserID == user.ID {
-			next.ServeHTTP(w, r)
-			return
-		}
-		// role precedence check
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
 
-		if err != nil {
-			app.internalServerError(w, r, err)
+		// owners can always act on their post
+		if err := subjectFromCtx(r).AuthorizeOn(post.UserID, perm); err != nil {
+			app.policyErrorResponse(w, r, err)
 			return
 		}
 
-		if !allowed {
-			app.forbiddenErrorResponse(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) checkCommentOwnership(perm policy.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		comment := getCommentFromCtx(r)
+
+		// owners can always act on their comment
+		if err := subjectFromCtx(r).AuthorizeOn(comment.UserID, perm); err != nil {
+			app.policyErrorResponse(w, r, err)
 			return
 		}
 
@@ -121,13 +145,15 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	})
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
-	role, err := app.store.Roles.GetByName(ctx, roleName)
-	if err != nil {
-		return false, nil
+// subjectFromCtx is the authenticated user as the policy sees them.
+func subjectFromCtx(r *http.Request) policy.Subject {
+	user := getUserFromContext(r)
+	return policy.Subject{
+		UserID:      user.ID,
+		Permissions: user.Role.Permissions,
+		MFARequired: user.Role.MFARequired,
+		MFA:         hasAMR(getClaimsFromContext(r), amrMFA),
 	}
-
-	return user.Role.Level >= role.Level, nil
 }
 
 func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error) {
@@ -152,6 +178,65 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 	return user, nil
 }
 
+// invalidateUser drops the cached user so the next request reads it from the
+// store again.
+func (app *application) invalidateUser(ctx context.Context, userID int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.User.Delete(ctx, userID); err != nil {
+		app.logger.Errorw("error invalidating user", "user", userID, "error", err)
+	}
+}
+
+// isTokenRevoked needs the jti and iat claims, tokens without them are treated as revoked.
+func (app *application) isTokenRevoked(ctx context.Context, claims jwt.MapClaims, userID int64) (bool, error) {
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return true, nil
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return true, nil
+	}
+
+	if !app.config.redisCfg.enabled {
+		return app.store.Revocations.IsRevoked(ctx, jti, userID, iat.Time)
+	}
+
+	revoked, found, err := app.cacheStorage.Revocations.Get(ctx, jti, userID, iat.Time)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		revoked, err = app.store.Revocations.IsRevoked(ctx, jti, userID, iat.Time)
+		if err != nil {
+			return false, err
+		}
+
+		if err := app.cacheStorage.Revocations.Set(ctx, jti, revoked, time.Minute); err != nil {
+			return false, err
+		}
+	}
+
+	return revoked, nil
+}
+
+// requirePermission only lets through users whose role was granted perm.
+func (app *application) requirePermission(perm policy.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := subjectFromCtx(r).Authorize(perm); err != nil {
+			app.policyErrorResponse(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
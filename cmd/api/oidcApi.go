@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/auth"
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errUnknownProvider = errors.New("unknown identity provider")
+	errInvalidState    = errors.New("the login expired or was already used")
+)
+
+// OIDCStart godoc
+//
+//	@summary		Starts an OpenID Connect login
+//	@description	Redirects to the identity provider, which sends the user back to the callback
+//	@tags			authentication
+//	@param			provider	path		string	true	"Identity provider"
+//	@success		302			{string}	string	"Redirect to the provider"
+//	@failure		404			{object}	error	"Unknown provider"
+//	@failure		500			{object}	error
+//	@router			/authentication/oidc/{provider}/start [get]
+func (app *application) oidcStartHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r, errUnknownProvider)
+		return
+	}
+
+	state, err := auth.RandomToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nonce, err := auth.RandomToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	verifier, challenge, err := auth.NewPKCE()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	ls := &store.OIDCLoginState{
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Expiry:       time.Now().Add(app.config.auth.oidc.stateExp),
+	}
+
+	if err := app.store.Identities.CreateLoginState(ctx, state, ls); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback godoc
+//
+//	@summary		Finishes an OpenID Connect login
+//	@description	Exchanges the authorization code for the user's identity and logs them in. First time identities are linked to the user with the same email, or to a new user, once the provider verified the email.
+//	@tags			authentication
+//	@produce		json
+//	@param			provider	path		string		true	"Identity provider"
+//	@param			code		query		string		true	"Authorization code"
+//	@param			state		query		string		true	"State"
+//	@success		201			{object}	TokenPair		"Tokens"
+//	@success		202			{object}	MFAChallenge	"Second factor required"
+//	@failure		400			{object}	error	"No verified email"
+//	@failure		401			{object}	error
+//	@failure		404			{object}	error	"Unknown provider"
+//	@failure		409			{object}	error	"Email taken by another account"
+//	@failure		500			{object}	error
+//	@router			/authentication/oidc/{provider}/callback [get]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r, errUnknownProvider)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	// the user cancelled or the provider refused
+	if e := qs.Get("error"); e != "" {
+		app.unauthorizedErrorResponse(w, r, errors.New(e))
+		return
+	}
+
+	code, state := qs.Get("code"), qs.Get("state")
+	if code == "" || state == "" {
+		app.badRequestResponse(w, r, errors.New("code and state are required"))
+		return
+	}
+
+	ctx := r.Context()
+
+	ls, err := app.store.Identities.ConsumeLoginState(ctx, state)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.badRequestResponse(w, r, errInvalidState)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if ls.Provider != provider.Name() {
+		app.badRequestResponse(w, r, errInvalidState)
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, code, ls.CodeVerifier, ls.Nonce)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	user, err := app.store.Identities.Login(ctx, &store.ExternalIdentity{
+		Provider:          provider.Name(),
+		Subject:           identity.Subject,
+		Email:             identity.Email,
+		EmailVerified:     identity.EmailVerified,
+		PreferredUsername: identity.PreferredUsername,
+	})
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.storeErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.issueTokens(w, r, user, []string{amrFederated})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/auth"
+	"github.com/Martins-Iroka/social/internal/auth/oidctest"
+)
+
+func TestOIDCLogin(t *testing.T) {
+	idp, err := oidctest.NewProvider("client-id", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idp.Close()
+
+	app := newTestApplication(t, config{
+		auth: authConfig{oidc: oidcConfig{stateExp: time.Minute}},
+	})
+	app.oidcProviders = map[string]*auth.OIDCProvider{
+		"fake": auth.NewOIDCProvider("fake", auth.OIDCConfig{
+			Issuer:       idp.URL,
+			ClientID:     idp.ClientID,
+			ClientSecret: idp.ClientSecret,
+			RedirectURL:  "http://localhost:8080/v1/authentication/oidc/fake/callback",
+		}, idp.Client()),
+	}
+	mux := app.mount()
+
+	// start returns the provider URL, the provider the callback URL
+	start := func(t *testing.T) *url.URL {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/fake/start", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusFound, rr.Code)
+
+		callback, err := idp.Authorize(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := url.Parse(callback)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	t.Run("should log in through the provider", func(t *testing.T) {
+		callback := start(t)
+
+		req, err := http.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("should refuse an identity without a verified email", func(t *testing.T) {
+		idp.EmailVerified = false
+		defer func() { idp.EmailVerified = true }()
+
+		callback := start(t)
+
+		req, err := http.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should not reuse a login state", func(t *testing.T) {
+		callback := start(t)
+
+		req, err := http.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusCreated, executeRequest(req, mux).Code)
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should reject a forged state", func(t *testing.T) {
+		callback := start(t)
+
+		q := callback.Query()
+		q.Set("state", "forged")
+		callback.RawQuery = q.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+
+	t.Run("should 404 an unknown provider", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/authentication/oidc/nope/start", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusNotFound, executeRequest(req, mux).Code)
+	})
+}
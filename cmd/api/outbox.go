@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+type outboxConfig struct {
+	enabled      bool
+	workers      int
+	batchSize    int
+	pollInterval time.Duration
+	// lease is how long a claimed email is hidden from the other workers
+	lease       time.Duration
+	maxAttempts int
+	// backoff is the delay before the second attempt, it doubles on every failure up to maxBackoff
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// runOutboxWorkers delivers the emails queued in the outbox until ctx is done.
+// Claims are made with SKIP LOCKED, so workers and api instances don't pick
+// the same email. Delivery is still at-least-once: an email whose lease
+// expires mid-send is claimed and sent again.
+func (app *application) runOutboxWorkers(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range app.config.outbox.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.outboxWorker(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (app *application) outboxWorker(ctx context.Context) {
+	ticker := time.NewTicker(app.config.outbox.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// keep draining while there is work, only wait once the outbox is empty
+		for app.deliverOutboxBatch(ctx) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverOutboxBatch reports whether it found a full batch, i.e. there's probably more to do.
+func (app *application) deliverOutboxBatch(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	emails, err := app.store.Outbox.Claim(ctx, app.config.outbox.batchSize, app.config.outbox.lease)
+	if err != nil {
+		app.logger.Errorw("error claiming outbox emails", "error", err)
+		return false
+	}
+
+	// the claimed emails are delivered and reported even when shutting down,
+	// otherwise the sent ones would be sent again once their lease expires
+	for _, email := range emails {
+		app.deliverEmail(context.WithoutCancel(ctx), email)
+	}
+
+	return len(emails) == app.config.outbox.batchSize
+}
+
+func (app *application) deliverEmail(ctx context.Context, email store.Email) {
+	isProdEnv := app.config.env == "production"
+
+	var data map[string]any
+	err := json.Unmarshal(email.Data, &data)
+	if err == nil {
+		err = app.mailer.Send(email.Template, email.Username, email.Email, email.Locale, data, !isProdEnv)
+	}
+
+	if err == nil {
+		if err := app.store.Outbox.MarkSent(ctx, email.ID); err != nil {
+			app.logger.Errorw("error marking email as sent", "id", email.ID, "error", err)
+		}
+		return
+	}
+
+	if email.Attempts >= app.config.outbox.maxAttempts {
+		app.logger.Errorw("email dead lettered", "id", email.ID, "attempts", email.Attempts, "error", err)
+		if err := app.store.Outbox.MarkDead(ctx, email.ID, err.Error()); err != nil {
+			app.logger.Errorw("error dead lettering email", "id", email.ID, "error", err)
+		}
+		return
+	}
+
+	nextAttempt := time.Now().Add(outboxBackoff(email.Attempts, app.config.outbox.backoff, app.config.outbox.maxBackoff))
+	app.logger.Warnw("error sending email, will retry", "id", email.ID, "attempts", email.Attempts, "next_attempt", nextAttempt, "error", err)
+	if err := app.store.Outbox.MarkFailed(ctx, email.ID, err.Error(), nextAttempt); err != nil {
+		app.logger.Errorw("error rescheduling email", "id", email.ID, "error", err)
+	}
+}
+
+// outboxBackoff is the exponential delay after the given number of failed attempts.
+func outboxBackoff(attempts int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+
+	return min(delay, maxDelay)
+}
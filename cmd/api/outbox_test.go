@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	base, maxDelay := time.Second*30, time.Hour
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, time.Second * 30},
+		{2, time.Minute},
+		{3, time.Minute * 2},
+		{7, time.Minute * 32},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts, base, maxDelay); got != tt.expected {
+			t.Errorf("attempt %d: expected %v; got %v", tt.attempts, tt.expected, got)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -8,13 +10,14 @@ import (
 )
 
 type PaginatedFeedQueryAPi struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit  int        `json:"limit" validate:"gte=1,lte=20"`
+	Offset int        `json:"offset" validate:"gte=0"`
+	Cursor string     `json:"cursor" validate:"excluded_unless=Offset 0"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc top hot trending"`
+	Tags   []string   `json:"tags" validate:"max=5"`
+	Search string     `json:"search" validate:"max=100"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
 }
 
 func (fq PaginatedFeedQueryAPi) Parse(r *http.Request) (PaginatedFeedQueryAPi, error) {
@@ -38,6 +41,11 @@ func (fq PaginatedFeedQueryAPi) Parse(r *http.Request) (PaginatedFeedQueryAPi, e
 		fq.Offset = l
 	}
 
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		fq.Cursor = cursor
+	}
+
 	sort := qs.Get("sort")
 	if sort != "" {
 		fq.Sort = sort
@@ -55,21 +63,142 @@ func (fq PaginatedFeedQueryAPi) Parse(r *http.Request) (PaginatedFeedQueryAPi, e
 
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, err
+		}
+		fq.Since = &t
 	}
 
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, err
+		}
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && fq.Until.Before(*fq.Since) {
+		return fq, errors.New("until must not be before since")
 	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
+// parseTime accepts RFC 3339 timestamps as well as the plain "2006-01-02 15:04:05"
+// form, which is read as UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
 	t, err := time.Parse(time.DateTime, s)
 	if err != nil {
-		return ""
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or %q", s, time.DateTime)
+	}
+
+	return t, nil
+}
+
+type PaginatedCommentQueryAPi struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor"`
+	Order  string `json:"order" validate:"oneof=asc desc"`
+}
+
+func (cq PaginatedCommentQueryAPi) Parse(r *http.Request) (PaginatedCommentQueryAPi, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq, err
+		}
+		cq.Limit = l
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		cq.Cursor = cursor
+	}
+
+	order := qs.Get("order")
+	if order != "" {
+		cq.Order = order
 	}
-	return t.Format(time.DateTime)
+
+	return cq, nil
+}
+
+type CommentThreadQueryAPi struct {
+	Depth int `json:"depth" validate:"gte=0,lte=5"`
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+}
+
+func (tq CommentThreadQueryAPi) Parse(r *http.Request) (CommentThreadQueryAPi, error) {
+	qs := r.URL.Query()
+
+	depth := qs.Get("depth")
+	if depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return tq, err
+		}
+		tq.Depth = d
+	}
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return tq, err
+		}
+		tq.Limit = l
+	}
+
+	return tq, nil
+}
+
+type PaginatedFollowQueryAPi struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor"`
+}
+
+func (fq PaginatedFollowQueryAPi) Parse(r *http.Request) (PaginatedFollowQueryAPi, error) {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return fq, err
+		}
+		fq.Limit = l
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		fq.Cursor = cursor
+	}
+
+	return fq, nil
+}
+
+type SuggestionQueryAPi struct {
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+}
+
+func (sq SuggestionQueryAPi) Parse(r *http.Request) (SuggestionQueryAPi, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+		sq.Limit = l
+	}
+
+	return sq, nil
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"should parse RFC 3339", "2024-05-01T12:30:00Z", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{"should keep the offset", "2024-05-01T12:30:00+02:00", time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), false},
+		{"should parse a plain date time as UTC", "2024-05-01 12:30:00", time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{"should reject a date", "2024-05-01", time.Time{}, true},
+		{"should reject garbage", "yesterday", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error; got %v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Equal(tt.want) {
+				t.Errorf("expected %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	defaults := PaginatedFeedQueryAPi{Limit: 20, Sort: "desc"}
+
+	tests := []struct {
+		name    string
+		query   string
+		check   func(PaginatedFeedQueryAPi) bool
+		wantErr bool
+	}{
+		{"should keep the defaults", "", func(fq PaginatedFeedQueryAPi) bool {
+			return fq.Limit == 20 && fq.Offset == 0 && fq.Sort == "desc" && fq.Tags == nil
+		}, false},
+		{"should read the limit and offset", "?limit=5&offset=10", func(fq PaginatedFeedQueryAPi) bool {
+			return fq.Limit == 5 && fq.Offset == 10
+		}, false},
+		{"should split the tags", "?tags=go,sql", func(fq PaginatedFeedQueryAPi) bool {
+			return len(fq.Tags) == 2 && fq.Tags[0] == "go" && fq.Tags[1] == "sql"
+		}, false},
+		{"should read the search and sort", "?search=hello&sort=asc", func(fq PaginatedFeedQueryAPi) bool {
+			return fq.Search == "hello" && fq.Sort == "asc"
+		}, false},
+		{"should read the time window", "?since=2024-05-01T00:00:00Z&until=2024-05-02%2000:00:00", func(fq PaginatedFeedQueryAPi) bool {
+			return fq.Since != nil && fq.Until != nil && fq.Until.Sub(*fq.Since) == 24*time.Hour
+		}, false},
+		{"should accept an empty time window", "?since=2024-05-01T00:00:00Z&until=2024-05-01T00:00:00Z", nil, false},
+		{"should reject a non numeric limit", "?limit=ten", nil, true},
+		{"should reject a non numeric offset", "?offset=ten", nil, true},
+		{"should reject an invalid since", "?since=yesterday", nil, true},
+		{"should reject an invalid until", "?until=tomorrow", nil, true},
+		{"should reject until before since", "?since=2024-05-02T00:00:00Z&until=2024-05-01T00:00:00Z", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/feed"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fq, err := defaults.Parse(req)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error; got %+v", fq)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.check != nil && !tt.check(fq) {
+				t.Errorf("unexpected query %+v", fq)
+			}
+		})
+	}
+}
+
+func TestReadFeedQueryFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"should accept five tags", "?tags=a,b,c,d,e", false},
+		{"should reject six tags", "?tags=a,b,c,d,e,f", true},
+		{"should accept a 100 character search", "?search=" + strings.Repeat("a", 100), false},
+		{"should reject a longer search", "?search=" + strings.Repeat("a", 101), true},
+		{"should reject a limit over 20", "?limit=21", true},
+		{"should reject a negative offset", "?offset=-1", true},
+		{"should reject an unknown sort", "?sort=random", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/v1/users/feed"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = readFeedQuery(req)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v; got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadFeedQueryCursors(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?sort=top&limit=10&cursor="+store.OffsetCursor{Offset: 30}.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fq, err := readFeedQuery(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fq.Offset != 30 || fq.Cursor != nil {
+		t.Errorf("expected the ranked page at offset 30; got %+v", fq)
+	}
+}
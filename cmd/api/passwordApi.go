@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/Martins-Iroka/social/internal/mailer"
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// ForgotPasswordHandler godoc
+//
+//	@summary		Requests a password reset
+//	@description	Emails a one-time password reset link. The response is the same whether the email exists or not.
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		ForgotPasswordPayload	true	"User email"
+//	@success		202		{string}	string					"Reset email sent if the user exists"
+//	@failure		400		{object}	error
+//	@failure		500		{object}	error
+//	@Router			/authentication/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.User.GetUserByEmail(ctx, payload.Email)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			// don't let the caller find out which emails are registered
+			if err := jsonResponse(w, http.StatusAccepted, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	token := uuid.New().String()
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	resetURL := fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, token)
+
+	vars := struct {
+		Username         string
+		ResetURL         string
+		ExpiresInMinutes int
+	}{
+		Username:         user.Username,
+		ResetURL:         resetURL,
+		ExpiresInMinutes: int(app.config.mail.passwordResetExpiry.Minutes()),
+	}
+
+	email, err := store.NewEmail(mailer.PasswordResetTemplate, user.Username, user.Email, user.Locale, vars)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.User.CreatePasswordReset(ctx, user.ID, hashToken, app.config.mail.passwordResetExpiry, email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// ResetPasswordHandler godoc
+//
+//	@summary		Resets a password
+//	@description	Sets a new password using the token from the reset email and signs the user out everywhere
+//	@tags			authentication
+//	@accept			json
+//	@produce		json
+//	@param			token	path		string					true	"Password reset token"
+//	@param			payload	body		ResetPasswordPayload	true	"New password"
+//	@success		204		{string}	string					"Password reset"
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error
+//	@failure		500		{object}	error
+//	@Router			/authentication/password/reset/{token} [put]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, revokedAt, err := app.store.User.ResetPassword(ctx, token, payload.Password)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the store already revoked the sessions, the cache has to know too
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Revocations.SetUserCutoff(ctx, user.ID, revokedAt, app.config.auth.token.exp); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+func TestForgotPassword(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"should accept a registered email", `{"email": "user@example.com"}`, http.StatusAccepted},
+		{"should answer the same for an unknown email", `{"email": "` + store.MockUnknownEmail + `"}`, http.StatusAccepted},
+		{"should reject an invalid email", `{"email": "not-an-email"}`, http.StatusBadRequest},
+		{"should require an email", `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/v1/authentication/password/forgot", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	tests := []struct {
+		name  string
+		token string
+		body  string
+		want  int
+	}{
+		{"should reset the password", "valid-reset-token", `{"password": "new-password"}`, http.StatusNoContent},
+		{"should reject an expired token", store.MockExpiredResetToken, `{"password": "new-password"}`, http.StatusNotFound},
+		{"should reject a short password", "valid-reset-token", `{"password": "ab"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPut, "/v1/authentication/password/reset/"+tt.token, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
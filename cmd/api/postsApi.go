@@ -14,6 +14,9 @@ type postKey string
 
 const postCtx postKey = "post"
 
+// embeddedCommentsLimit is how many comments getPostHandler embeds in the post
+const embeddedCommentsLimit = 20
+
 type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
@@ -26,7 +29,7 @@ type UpdatePostPayload struct {
 }
 
 type CommentPayload struct {
-	Content string `json:"content"`
+	Content string `json:"content" validate:"required,max=1000"`
 }
 
 // CreatePost godoc
@@ -71,31 +74,88 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.fanOutPost(ctx, post)
+
 	if err := jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// ListPosts godoc
+//
+//	@Summary		Lists every post
+//	@Description	Lists the posts of every user, newest, top or hot first. Pass next_cursor as cursor to get the next page. Top, hot and trending only rank the 500 newest matching posts.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			since	query		string	false	"Since (RFC 3339 or 2006-01-02 15:04:05)"
+//	@Param			until	query		string	false	"Until (RFC 3339 or 2006-01-02 15:04:05)"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset, can't be combined with cursor"
+//	@Param			cursor	query		string	false	"Cursor, the next_cursor of the previous page"
+//	@Param			sort	query		string	false	"Sort (asc, desc, top, hot or trending)"
+//	@Param			tags	query		string	false	"Comma separated tags, posts must have all of them"
+//	@Param			search	query		string	false	"Search in title and content"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts [get]
+func (app *application) listPostsHandler(w http.ResponseWriter, r *http.Request) {
+	feedQuery, err := readFeedQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	posts, next, err := app.store.Post.GetPosts(r.Context(), user.ID, feedQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonPaginatedResponse(w, http.StatusOK, posts, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 // GetPost godoc
 //
 //	@Summary		Fetches a post
-//	@Description	Fetches a post by ID
+//	@Description	Fetches a post by ID with its newest comments and reactions
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
-//	@Success		200	{object}	store.Post
+//	@Success		200	{object}	store.PostWithMetadata
 //	@Failure		404	{object}	error
 //	@Failure		500	{object}	error
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
-	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
 
 	ctx := r.Context()
 
-	comments, err := app.store.Comment.GetByPostID(ctx, post.ID)
+	post, err := app.store.Post.GetWithMetadata(ctx, getPostFromCtx(r).ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// only the newest comments are embedded, the rest are paged through /comments
+	comments, _, err := app.store.Comment.ListByPostID(ctx, post.ID, &store.PaginatedCommentQuery{
+		Limit: embeddedCommentsLimit,
+		Order: "desc",
+	})
 	if err != nil {
 		app.internalServerError(w, r, errors.New(err.Error()+" from comments getbypostid"))
 		return
@@ -142,14 +202,17 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 // CreateCommentPost godoc
 //
 //	@Summary		Create a comment for a a post
-//	@Description	Updates a post by ID
+//	@Description	Creates a comment on a post by ID
 //	@Tags			posts
 //	@Accept			json
+//	@Param			id		path		int				true	"Post ID"
 //	@Param			payload	body		CommentPayload	true	"Comment payload"
-//	@Success		200		{object}	store.Comment
+//	@Success		201		{object}	store.Comment
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
 //	@Failure		500		{object}	error
 //	@Security		ApiKeyAuth
-//	@Router			/posts/{id}/comments [patch]
+//	@Router			/posts/{id}/comments [post]
 func (app *application) createCommentPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
@@ -164,16 +227,23 @@ func (app *application) createCommentPostHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	user := getUserFromContext(r)
+
 	comment := &store.Comment{
 		Content: payload.Content,
 		PostID:  post.ID,
-		UserID:  post.UserID,
+		UserID:  user.ID,
 	}
 
 	ctx := r.Context()
 
 	if err := app.store.Comment.CreateComment(ctx, comment); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrorBlocked):
+			app.forbiddenErrorResponse(w, r)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -261,6 +331,19 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// posts the caller can't read (blocked, or private and not an
+		// approved follower) don't exist for them
+		visible, err := app.store.User.CanViewPosts(ctx, post.UserID, getUserFromContext(r).ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible {
+			app.notFoundResponse(w, r, store.ErrorNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPostListings(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		want int
+	}{
+		{"should list every post", "/v1/posts", http.StatusOK},
+		{"should filter every post", "/v1/posts?tags=go&search=hello&since=2024-05-01T00:00:00Z", http.StatusOK},
+		{"should reject an invalid filter", "/v1/posts?since=yesterday", http.StatusBadRequest},
+		{"should list the posts of a user", "/v1/users/7/posts", http.StatusOK},
+		{"should filter the posts of a user", "/v1/users/7/posts?sort=asc&limit=5", http.StatusOK},
+		{"should reject an invalid user filter", "/v1/users/7/posts?limit=100", http.StatusBadRequest},
+		{"should reject an invalid user id", "/v1/users/seven/posts", http.StatusBadRequest},
+		{"should not find the posts of a missing user", "/v1/users/404/posts", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
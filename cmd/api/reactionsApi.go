@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// ReactToPost godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Adds a reaction of the given kind to a post. Reacting twice with the same kind is a no-op.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind (like, love, laugh, wow, sad, angry)"
+//	@Success		204		{string}	string	"Reaction added"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions/{kind} [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	kind, err := readReactionKind(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Reactions.React(r.Context(), post.ID, user.ID, kind); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// RemoveReaction godoc
+//
+//	@Summary		Removes a reaction from a post
+//	@Description	Removes the caller's reaction of the given kind. Removing a reaction that isn't there is a no-op.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind (like, love, laugh, wow, sad, angry)"
+//	@Success		204		{string}	string	"Reaction removed"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions/{kind} [delete]
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	kind, err := readReactionKind(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Reactions.Unreact(r.Context(), post.ID, user.ID, kind); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func readReactionKind(r *http.Request) (string, error) {
+	kind := strings.ToLower(chi.URLParam(r, "kind"))
+	if !slices.Contains(store.ReactionKinds, kind) {
+		return "", fmt.Errorf("unknown reaction kind %q", kind)
+	}
+
+	return kind, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReactions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not allow unauthenticated requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/v1/posts/1/reactions/like", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   int
+	}{
+		{"should react to a post", http.MethodPut, "/v1/posts/1/reactions/like", http.StatusNoContent},
+		{"should accept the kind in any case", http.MethodPut, "/v1/posts/1/reactions/LOVE", http.StatusNoContent},
+		{"should react to another user's post", http.MethodPut, "/v1/posts/2/reactions/wow", http.StatusNoContent},
+		{"should reject an unknown kind", http.MethodPut, "/v1/posts/1/reactions/meh", http.StatusBadRequest},
+		{"should not react to a missing post", http.MethodPut, "/v1/posts/404/reactions/like", http.StatusNotFound},
+		{"should remove a reaction", http.MethodDelete, "/v1/posts/1/reactions/like", http.StatusNoContent},
+		{"should reject removing an unknown kind", http.MethodDelete, "/v1/posts/1/reactions/meh", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
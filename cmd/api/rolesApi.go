@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Martins-Iroka/social/internal/policy"
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateRolePayload struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=1000"`
+	Level       int    `json:"level" validate:"gte=0,lte=100"`
+	// MFARequired only grants the permissions to sessions that passed
+	// two-factor authentication
+	MFARequired bool `json:"mfa_required"`
+}
+
+type UpdateRolePayload struct {
+	Name        *string `json:"name" validate:"omitempty,max=255"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+	Level       *int    `json:"level" validate:"omitempty,gte=0,lte=100"`
+	MFARequired *bool   `json:"mfa_required"`
+}
+
+type RolePermissionsPayload struct {
+	Permissions []string `json:"permissions" validate:"required,dive,required"`
+}
+
+type AssignRolePayload struct {
+	RoleID int64 `json:"role_id" validate:"required"`
+}
+
+// ListRoles godoc
+//
+//	@summary		Lists the roles
+//	@description	Lists the roles from the lowest level to the highest
+//	@tags			roles
+//	@produce		json
+//	@success		200	{object}	[]store.Role
+//	@failure		403	{object}	error
+//	@failure		500	{object}	error
+//	@security		ApiKeyAuth
+//	@router			/roles [get]
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Roles.GetAll(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// CreateRole godoc
+//
+//	@summary		Creates a role
+//	@description	Creates a custom role without permissions, grant them with PUT /roles/{roleID}/permissions
+//	@tags			roles
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		CreateRolePayload	true	"Role payload"
+//	@success		201		{object}	store.Role
+//	@failure		400		{object}	error
+//	@failure		403		{object}	error
+//	@failure		409		{object}	error	"Role name taken"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/roles [post]
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	role := &store.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Level:       payload.Level,
+		MFARequired: payload.MFARequired,
+	}
+
+	if err := app.store.Roles.Create(r.Context(), role); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusCreated, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateRole godoc
+//
+//	@summary		Updates a role
+//	@description	Updates a custom role, the built-in user, moderator and admin roles can't be modified
+//	@tags			roles
+//	@accept			json
+//	@produce		json
+//	@param			roleID	path		int					true	"Role ID"
+//	@param			payload	body		UpdateRolePayload	true	"Role payload"
+//	@success		200		{object}	store.Role
+//	@failure		400		{object}	error
+//	@failure		403		{object}	error
+//	@failure		404		{object}	error
+//	@failure		409		{object}	error	"Built-in role or name taken"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/roles/{roleID} [put]
+func (app *application) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload UpdateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	role, err := app.store.Roles.GetByID(ctx, roleID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if payload.Name != nil {
+		role.Name = *payload.Name
+	}
+
+	if payload.Description != nil {
+		role.Description = *payload.Description
+	}
+
+	if payload.Level != nil {
+		role.Level = *payload.Level
+	}
+
+	if payload.MFARequired != nil {
+		role.MFARequired = *payload.MFARequired
+	}
+
+	if err := app.store.Roles.Update(ctx, role); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.invalidateRoleHolders(ctx, role.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// SetRolePermissions godoc
+//
+//	@summary		Sets the permissions of a role
+//	@description	Replaces the permissions granted to a custom role, the built-in roles keep the ones seeded by the migrations. The users holding the role get the new permissions on their next request.
+//	@tags			roles
+//	@accept			json
+//	@produce		json
+//	@param			roleID	path		int						true	"Role ID"
+//	@param			payload	body		RolePermissionsPayload	true	"Permissions"
+//	@success		200		{object}	store.Role
+//	@failure		400		{object}	error	"Unknown permission"
+//	@failure		403		{object}	error
+//	@failure		404		{object}	error
+//	@failure		409		{object}	error	"Built-in role"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/roles/{roleID}/permissions [put]
+func (app *application) setRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload RolePermissionsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	for _, p := range payload.Permissions {
+		if !policy.Known(p) {
+			app.badRequestResponse(w, r, fmt.Errorf("unknown permission %q", p))
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Roles.SetPermissions(ctx, roleID, payload.Permissions); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := app.invalidateRoleHolders(ctx, roleID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	role, err := app.store.Roles.GetByID(ctx, roleID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// AssignRole godoc
+//
+//	@summary		Assigns a role to a user
+//	@description	Assigns a role to a user, it applies to the user's next request
+//	@tags			roles
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int					true	"User ID"
+//	@param			payload	body		AssignRolePayload	true	"Role"
+//	@success		204		{string}	string				"Role assigned"
+//	@failure		400		{object}	error
+//	@failure		403		{object}	error
+//	@failure		404		{object}	error	"User or role not found"
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/role [put]
+func (app *application) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload AssignRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Roles.Assign(ctx, userID, payload.RoleID); err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	// authTokenMiddleware reads the role from the cached user
+	app.invalidateUser(ctx, userID)
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// invalidateRoleHolders drops the cached users holding roleID, their cache
+// entries embed the role that authTokenMiddleware authorizes them with.
+func (app *application) invalidateRoleHolders(ctx context.Context, roleID int64) error {
+	if !app.config.redisCfg.enabled {
+		return nil
+	}
+
+	userIDs, err := app.store.Roles.GetUserIDs(ctx, roleID)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		if err := app.cacheStorage.User.Delete(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
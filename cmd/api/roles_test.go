@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/Martins-Iroka/social/internal/store/cache"
+)
+
+func TestRoles(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	userToken := newTestToken(t, app, 42)
+	adminToken := newTestToken(t, app, store.MockAdminID)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		token  string
+		body   string
+		want   int
+	}{
+		{"should only let admins list the roles", http.MethodGet, "/v1/roles", userToken, "", http.StatusForbidden},
+		{"should list the roles", http.MethodGet, "/v1/roles", adminToken, "", http.StatusOK},
+		{"should create a role", http.MethodPost, "/v1/roles", adminToken, `{"name": "editor", "level": 2}`, http.StatusCreated},
+		{"should only let admins create roles", http.MethodPost, "/v1/roles", userToken, `{"name": "editor", "level": 2}`, http.StatusForbidden},
+		{"should require a role name", http.MethodPost, "/v1/roles", adminToken, `{"level": 2}`, http.StatusBadRequest},
+		{"should reject a level over 100", http.MethodPost, "/v1/roles", adminToken, `{"name": "editor", "level": 101}`, http.StatusBadRequest},
+		{"should reject a duplicate role", http.MethodPost, "/v1/roles", adminToken, `{"name": "admin"}`, http.StatusConflict},
+		{"should update a role", http.MethodPut, "/v1/roles/5", adminToken, `{"description": "edits posts"}`, http.StatusOK},
+		{"should not update a built-in role", http.MethodPut, "/v1/roles/1", adminToken, `{"level": 1}`, http.StatusConflict},
+		{"should not update a missing role", http.MethodPut, "/v1/roles/404", adminToken, `{"level": 1}`, http.StatusNotFound},
+		{"should reject an invalid role id", http.MethodPut, "/v1/roles/editor", adminToken, `{"level": 1}`, http.StatusBadRequest},
+		{"should set the permissions of a role", http.MethodPut, "/v1/roles/5/permissions", adminToken, `{"permissions": ["posts:update:any"]}`, http.StatusOK},
+		{"should reject an unknown permission", http.MethodPut, "/v1/roles/5/permissions", adminToken, `{"permissions": ["posts:burn"]}`, http.StatusBadRequest},
+		{"should require the permissions", http.MethodPut, "/v1/roles/5/permissions", adminToken, `{}`, http.StatusBadRequest},
+		{"should not set the permissions of a built-in role", http.MethodPut, "/v1/roles/1/permissions", adminToken, `{"permissions": []}`, http.StatusConflict},
+		{"should assign a role", http.MethodPut, "/v1/users/7/role", adminToken, `{"role_id": 5}`, http.StatusNoContent},
+		{"should only let admins assign roles", http.MethodPut, "/v1/users/7/role", userToken, `{"role_id": 5}`, http.StatusForbidden},
+		{"should not assign a missing role", http.MethodPut, "/v1/users/7/role", adminToken, `{"role_id": 404}`, http.StatusNotFound},
+		{"should not assign a role to a missing user", http.MethodPut, "/v1/users/404/role", adminToken, `{"role_id": 5}`, http.StatusNotFound},
+		{"should require the role to assign", http.MethodPut, "/v1/users/7/role", adminToken, `{}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, tt.want, rr.Code)
+		})
+	}
+}
+
+// testUserCache records the users dropped from the cache.
+type testUserCache struct {
+	cache.MockUserStore
+	deleted []int64
+}
+
+func (c *testUserCache) Delete(ctx context.Context, id int64) error {
+	c.deleted = append(c.deleted, id)
+	return nil
+}
+
+func TestRoleChangesInvalidateHolders(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{"should drop the holders of an updated role", "/v1/roles/5", `{"mfa_required": true}`},
+		{"should drop the holders of a role whose permissions changed", "/v1/roles/5/permissions", `{"permissions": []}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t, config{redisCfg: redisConfig{enabled: true}})
+			mux := app.mount()
+
+			userCache := &testUserCache{}
+			app.cacheStorage.User = userCache
+
+			req, err := http.NewRequest(http.MethodPut, tt.url, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Authorization", "Bearer "+newTestToken(t, app, store.MockAdminID))
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusOK, rr.Code)
+
+			if !slices.Contains(userCache.deleted, store.MockOtherUserID) {
+				t.Errorf("expected the holders of the role to be dropped from the cache; got %v", userCache.deleted)
+			}
+		})
+	}
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Martins-Iroka/social/internal/auth"
+	"github.com/Martins-Iroka/social/internal/mailer"
 	"github.com/Martins-Iroka/social/internal/ratelimiter"
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/Martins-Iroka/social/internal/store/cache"
 	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 )
 
@@ -23,15 +27,40 @@ func newTestApplication(t *testing.T, config config) *application {
 		config.rateLimiter.RequestsPerTimeFrame,
 		config.rateLimiter.TimeFrame,
 	)
+	emailRateLimiter := ratelimiter.NewBoundedFixedWindowLimiter(
+		config.emailRateLimiter.RequestsPerTimeFrame,
+		config.emailRateLimiter.TimeFrame,
+		config.emailRateLimiter.MaxKeys,
+	)
 	testAuth := &auth.TestAuthenticator{}
 	return &application{
 		logger:        logger,
 		store:         mockStore,
 		cacheStorage:  mockCacheStore,
 		authenticator: testAuth,
+		mailer:        &mailer.TestMailer{},
 		config:        config,
 		ratelimiter:   rateLimiter,
+
+		emailRateLimiter: emailRateLimiter,
+	}
+}
+
+// newTestToken returns an access token of userID.
+func newTestToken(t *testing.T, app *application, userID int64) string {
+	t.Helper()
+
+	token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+		"sub": userID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+		"jti": "test-jti-" + strconv.FormatInt(userID, 10),
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
+
+	return token
 }
 
 func executeRequest(req *http.Request, mux *chi.Mux) *httptest.ResponseRecorder {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+)
+
+type timelineConfig struct {
+	// maxLen is how many posts a cached timeline keeps, older pages come from the database
+	maxLen int
+	// celebrityThreshold is the follower count above which posts aren't fanned out to followers
+	celebrityThreshold int
+	ttl                time.Duration
+}
+
+// fanOutPost pushes a new post into the cached timelines of its author and
+// their followers. The post is already saved, so failures are only logged: a
+// timeline that misses a post is rebuilt once it expires.
+func (app *application) fanOutPost(ctx context.Context, post *store.Post) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	threshold := app.config.timeline.celebrityThreshold
+
+	followers, err := app.store.User.GetFollowerIDs(ctx, post.UserID, threshold+1)
+	if err != nil {
+		app.logger.Errorw("error loading followers for fan out", "post", post.ID, "error", err)
+		return
+	}
+
+	// pushing to that many timelines isn't worth it, their followers read the
+	// feed from the database, the author still gets the post in their own
+	userIDs := append(followers, post.UserID)
+	if len(followers) > threshold {
+		if err := app.cacheStorage.Timelines.AddCelebrity(ctx, post.UserID); err != nil {
+			app.logger.Errorw("error marking celebrity", "user", post.UserID, "error", err)
+		}
+		userIDs = []int64{post.UserID}
+	}
+
+	if err := app.cacheStorage.Timelines.Push(ctx, post.ID, userIDs, app.config.timeline.maxLen); err != nil {
+		app.logger.Errorw("error fanning out post", "post", post.ID, "error", err)
+	}
+}
+
+// getTimelineFeed serves the feed from the user's cached timeline. ok is false
+// when the query can't be answered from the cache and the database has to be
+// used instead: filters, offset or ascending pagination, following a celebrity
+// or paging past what the timeline kept.
+func (app *application) getTimelineFeed(ctx context.Context, userID int64, fq *store.PaginatedFeedQuery) ([]store.PostWithMetadata, string, bool, error) {
+	if fq.Offset > 0 || fq.Sort != "desc" || len(fq.Tags) > 0 || fq.Search != "" || fq.Since != nil || fq.Until != nil {
+		return nil, "", false, nil
+	}
+
+	celebrities, err := app.cacheStorage.Timelines.Celebrities(ctx)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	if len(celebrities) > 0 {
+		follows, err := app.store.User.FollowsAny(ctx, userID, celebrities)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if follows {
+			return nil, "", false, nil
+		}
+	}
+
+	var beforeID int64
+	if fq.Cursor != nil {
+		beforeID = fq.Cursor.ID
+	}
+
+	// one extra ID tells if there's a next page
+	page, err := app.cacheStorage.Timelines.Get(ctx, userID, beforeID, fq.Limit+1)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	if page == nil {
+		if err := app.rebuildTimeline(ctx, userID); err != nil {
+			return nil, "", false, err
+		}
+
+		page, err = app.cacheStorage.Timelines.Get(ctx, userID, beforeID, fq.Limit+1)
+		if err != nil || page == nil {
+			return nil, "", false, err
+		}
+	}
+
+	more := len(page.PostIDs) > fq.Limit
+	if !more && !page.Complete {
+		return nil, "", false, nil
+	}
+
+	ids := page.PostIDs[:min(len(page.PostIDs), fq.Limit)]
+
+	feed, err := app.store.Post.GetByIDs(ctx, ids, userID)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	if !more {
+		return feed, "", true, nil
+	}
+
+	// deleted posts stay in timelines until they're rebuilt, so the page can
+	// come back short; the database takes over when none of it is left
+	if len(feed) == 0 {
+		return nil, "", false, nil
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, feed[len(feed)-1].CreatedAt)
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	next := store.Cursor{CreatedAt: createdAt, ID: ids[len(ids)-1]}.Encode()
+
+	return feed, next, true, nil
+}
+
+func (app *application) rebuildTimeline(ctx context.Context, userID int64) error {
+	maxLen := app.config.timeline.maxLen
+
+	ids, err := app.store.Post.GetUserFeedIDs(ctx, userID, maxLen)
+	if err != nil {
+		return err
+	}
+
+	return app.cacheStorage.Timelines.Set(ctx, userID, ids, len(ids) < maxLen, app.config.timeline.ttl)
+}
+
+// invalidateTimeline drops the cached timeline of a user whose follows changed.
+func (app *application) invalidateTimeline(ctx context.Context, userID int64) {
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Delete(ctx, userID); err != nil {
+		app.logger.Errorw("error invalidating timeline", "user", userID, "error", err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/Martins-Iroka/social/internal/store/cache"
+)
+
+// testTimelines keeps a single timeline in memory, newest post first.
+type testTimelines struct {
+	cache.MockTimelineStore
+	postIDs     []int64
+	complete    bool
+	cached      bool
+	pushed      []int64
+	celebrities []int64
+}
+
+func (s *testTimelines) Get(ctx context.Context, userID, beforeID int64, limit int) (*cache.TimelinePage, error) {
+	if !s.cached {
+		return nil, nil
+	}
+
+	var ids []int64
+	for _, id := range s.postIDs {
+		if beforeID == 0 || id < beforeID {
+			ids = append(ids, id)
+		}
+	}
+
+	return &cache.TimelinePage{PostIDs: ids[:min(len(ids), limit)], Complete: s.complete}, nil
+}
+
+func (s *testTimelines) Set(ctx context.Context, userID int64, postIDs []int64, complete bool, ttl time.Duration) error {
+	s.postIDs, s.complete, s.cached = postIDs, complete, true
+	return nil
+}
+
+func (s *testTimelines) Push(ctx context.Context, postID int64, userIDs []int64, maxLen int) error {
+	s.pushed = userIDs
+	return nil
+}
+
+func (s *testTimelines) AddCelebrity(ctx context.Context, userID int64) error {
+	s.celebrities = append(s.celebrities, userID)
+	return nil
+}
+
+func (s *testTimelines) Celebrities(ctx context.Context) ([]int64, error) {
+	return s.celebrities, nil
+}
+
+// testTimelinePosts has every post of the database feed, feedIDs, and dates
+// posts by their ID.
+type testTimelinePosts struct {
+	store.MockPostStore
+	feedIDs []int64
+}
+
+func (s *testTimelinePosts) GetUserFeedIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	return s.feedIDs[:min(len(s.feedIDs), limit)], nil
+}
+
+func (s *testTimelinePosts) GetByIDs(ctx context.Context, postIDs []int64, userID int64) ([]store.PostWithMetadata, error) {
+	posts := make([]store.PostWithMetadata, 0, len(postIDs))
+	for _, id := range postIDs {
+		createdAt := time.Unix(id, 0).UTC().Format(time.RFC3339Nano)
+		posts = append(posts, store.PostWithMetadata{Post: store.Post{ID: id, CreatedAt: createdAt}})
+	}
+	return posts, nil
+}
+
+// testFollowers gives every user followers followers, all following the celebrities.
+type testFollowers struct {
+	store.MockUserStore
+	followers int
+}
+
+func (s *testFollowers) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	ids := make([]int64, 0, s.followers)
+	for i := range min(s.followers, limit) {
+		ids = append(ids, int64(100+i))
+	}
+	return ids, nil
+}
+
+func (s *testFollowers) FollowsAny(ctx context.Context, followerID int64, userIDs []int64) (bool, error) {
+	return len(userIDs) > 0, nil
+}
+
+func newTimelineTestApplication(t *testing.T, timelines *testTimelines, feedIDs []int64) *application {
+	t.Helper()
+
+	app := newTestApplication(t, config{
+		redisCfg: redisConfig{enabled: true},
+		timeline: timelineConfig{maxLen: 5, celebrityThreshold: 2, ttl: time.Hour},
+	})
+	app.store.Post = &testTimelinePosts{feedIDs: feedIDs}
+	app.store.User = &testFollowers{followers: 2}
+	app.cacheStorage.Timelines = timelines
+
+	return app
+}
+
+func TestGetTimelineFeed(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should leave filtered and offset queries to the database", func(t *testing.T) {
+		timelines := &testTimelines{postIDs: []int64{3, 2, 1}, complete: true, cached: true}
+		app := newTimelineTestApplication(t, timelines, nil)
+
+		since := time.Now()
+		queries := []store.PaginatedFeedQuery{
+			{Limit: 2, Sort: "desc", Offset: 2},
+			{Limit: 2, Sort: "asc"},
+			{Limit: 2, Sort: "desc", Tags: []string{"go"}},
+			{Limit: 2, Sort: "desc", Search: "hello"},
+			{Limit: 2, Sort: "desc", Since: &since},
+		}
+
+		for _, fq := range queries {
+			if _, _, ok, err := app.getTimelineFeed(ctx, 42, &fq); ok || err != nil {
+				t.Errorf("expected %+v to fall back to the database; got %v, %v", fq, ok, err)
+			}
+		}
+	})
+
+	t.Run("should page through the cached timeline", func(t *testing.T) {
+		timelines := &testTimelines{postIDs: []int64{3, 2, 1}, complete: true, cached: true}
+		app := newTimelineTestApplication(t, timelines, nil)
+
+		feed, next, ok, err := app.getTimelineFeed(ctx, 42, &store.PaginatedFeedQuery{Limit: 2, Sort: "desc"})
+		if err != nil || !ok {
+			t.Fatalf("expected the cached timeline; got %v, %v", ok, err)
+		}
+
+		if len(feed) != 2 || feed[0].ID != 3 || feed[1].ID != 2 {
+			t.Fatalf("expected posts 3 and 2; got %+v", feed)
+		}
+
+		cursor, err := store.DecodeCursor(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		feed, next, ok, err = app.getTimelineFeed(ctx, 42, &store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Cursor: cursor})
+		if err != nil || !ok {
+			t.Fatalf("expected the cached timeline; got %v, %v", ok, err)
+		}
+
+		if len(feed) != 1 || feed[0].ID != 1 || next != "" {
+			t.Errorf("expected the last page with post 1; got %+v, %q", feed, next)
+		}
+	})
+
+	t.Run("should fall back once a trimmed timeline runs out", func(t *testing.T) {
+		timelines := &testTimelines{postIDs: []int64{3, 2, 1}, complete: false, cached: true}
+		app := newTimelineTestApplication(t, timelines, nil)
+
+		cursor := &store.Cursor{CreatedAt: time.Unix(2, 0), ID: 2}
+		if _, _, ok, err := app.getTimelineFeed(ctx, 42, &store.PaginatedFeedQuery{Limit: 2, Sort: "desc", Cursor: cursor}); ok || err != nil {
+			t.Errorf("expected the database to take over; got %v, %v", ok, err)
+		}
+	})
+
+	t.Run("should rebuild a missing timeline", func(t *testing.T) {
+		timelines := &testTimelines{}
+		app := newTimelineTestApplication(t, timelines, []int64{2, 1})
+
+		feed, next, ok, err := app.getTimelineFeed(ctx, 42, &store.PaginatedFeedQuery{Limit: 2, Sort: "desc"})
+		if err != nil || !ok {
+			t.Fatalf("expected the rebuilt timeline; got %v, %v", ok, err)
+		}
+
+		if !timelines.cached || !timelines.complete {
+			t.Errorf("expected a complete timeline to be cached; got %+v", timelines)
+		}
+
+		if len(feed) != 2 || next != "" {
+			t.Errorf("expected both posts on a single page; got %+v, %q", feed, next)
+		}
+	})
+
+	t.Run("should leave followers of celebrities to the database", func(t *testing.T) {
+		timelines := &testTimelines{postIDs: []int64{3, 2, 1}, complete: true, cached: true, celebrities: []int64{7}}
+		app := newTimelineTestApplication(t, timelines, nil)
+
+		if _, _, ok, err := app.getTimelineFeed(ctx, 42, &store.PaginatedFeedQuery{Limit: 2, Sort: "desc"}); ok || err != nil {
+			t.Errorf("expected the database to take over; got %v, %v", ok, err)
+		}
+	})
+}
+
+func TestFanOutPost(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should push the post to the author and their followers", func(t *testing.T) {
+		timelines := &testTimelines{}
+		app := newTimelineTestApplication(t, timelines, nil)
+
+		app.fanOutPost(ctx, &store.Post{ID: 1, UserID: 42})
+
+		if !slices.Equal(timelines.pushed, []int64{100, 101, 42}) {
+			t.Errorf("expected the post pushed to 100, 101 and 42; got %v", timelines.pushed)
+		}
+	})
+
+	t.Run("should only push the posts of celebrities to their own timeline", func(t *testing.T) {
+		timelines := &testTimelines{}
+		app := newTimelineTestApplication(t, timelines, nil)
+		app.store.User = &testFollowers{followers: 3}
+
+		app.fanOutPost(ctx, &store.Post{ID: 1, UserID: 42})
+
+		if !slices.Equal(timelines.pushed, []int64{42}) || !slices.Equal(timelines.celebrities, []int64{42}) {
+			t.Errorf("expected the post pushed to 42 only and 42 marked as a celebrity; got %v, %v", timelines.pushed, timelines.celebrities)
+		}
+	})
+}
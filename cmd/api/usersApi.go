@@ -1,17 +1,66 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/Martins-Iroka/social/internal/mailer"
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type FollowUser struct {
 	UserID int64 `json:"user_id"`
 }
 
+// UserProfile is a user as anyone sees them, with their follow counts,
+// IsFollowing and FollowsYou being relative to the caller. It leaves out
+// whether the account uses two-factor authentication and what its role grants.
+type UserProfile struct {
+	ID        int64       `json:"id"`
+	Username  string      `json:"username"`
+	Email     string      `json:"email"`
+	CreatedAt string      `json:"created_at"`
+	IsActive  bool        `json:"is_active"`
+	IsPrivate bool        `json:"is_private"`
+	RoleID    int64       `json:"role_id"`
+	Role      ProfileRole `json:"role"`
+	*store.FollowStats
+}
+
+type ProfileRole struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Level       int    `json:"level"`
+}
+
+func newUserProfile(user *store.User, stats *store.FollowStats) *UserProfile {
+	return &UserProfile{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		IsActive:  user.IsActive,
+		IsPrivate: user.IsPrivate,
+		RoleID:    user.RoleID,
+		Role: ProfileRole{
+			ID:          user.Role.ID,
+			Name:        user.Role.Name,
+			Description: user.Role.Description,
+			Level:       user.Role.Level,
+		},
+		FollowStats: stats,
+	}
+}
+
 type userKey string
 
 const userContextKey userKey = "user"
@@ -19,12 +68,12 @@ const userContextKey userKey = "user"
 // GetUser godoc
 //
 //	@summary		Fetches a user
-//	@description	Fetches a user profile by ID
+//	@description	Fetches a user profile by ID with their follow counts
 //	@tags			users
 //	@accept			json
 //	@produce		json
 //	@param			userID	path		int	true	"User ID"
-//	@success		200		{object}	store.User
+//	@success		200		{object}	UserProfile
 //	@failure		400		{object}	error
 //	@failure		404		{object}	error
 //	@failure		500		{object}	error
@@ -52,7 +101,184 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := jsonResponse(w, http.StatusOK, user); err != nil {
+	stats, err := app.store.User.GetFollowStats(ctx, user.ID, getUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, newUserProfile(user, stats)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// GetFollowers godoc
+//
+//	@summary		Lists the followers of a user
+//	@description	Lists the followers of a user newest first. Pass next_cursor as cursor to get the next page.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@param			limit	query		int		false	"Limit"
+//	@param			cursor	query		string	false	"Cursor"
+//	@success		200		{object}	[]store.Connection
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/followers	[get]
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listConnections(w, r, app.store.User.ListFollowers)
+}
+
+// GetFollowing godoc
+//
+//	@summary		Lists the users a user follows
+//	@description	Lists the users a user follows newest first. Pass next_cursor as cursor to get the next page.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@param			limit	query		int		false	"Limit"
+//	@param			cursor	query		string	false	"Cursor"
+//	@success		200		{object}	[]store.Connection
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/following	[get]
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listConnections(w, r, app.store.User.ListFollowing)
+}
+
+type listConnectionsFunc func(ctx context.Context, userID, viewerID int64, q *store.PaginatedFollowQuery) ([]store.Connection, string, error)
+
+// listConnections serves the followers and following lists of the user in the URL.
+func (app *application) listConnections(w http.ResponseWriter, r *http.Request, list listConnectionsFunc) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	followQuery, err := readFollowQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	connections, next, err := list(ctx, user.ID, getUserFromContext(r).ID, followQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonPaginatedResponse(w, http.StatusOK, connections, next); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readFollowQuery reads the limit and cursor of the follow lists.
+func readFollowQuery(r *http.Request) (*store.PaginatedFollowQuery, error) {
+	fq := PaginatedFollowQueryAPi{
+		Limit: 20,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		return nil, err
+	}
+
+	followQuery := &store.PaginatedFollowQuery{
+		Limit: fq.Limit,
+	}
+
+	if fq.Cursor != "" {
+		cursor, err := store.DecodeCursor(fq.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		followQuery.Cursor = cursor
+	}
+
+	return followQuery, nil
+}
+
+// GetUserPosts godoc
+//
+//	@summary		Lists the posts of a user
+//	@description	Lists the posts of a user profile. Pass next_cursor as cursor to get the next page. Top, hot and trending only rank the 500 newest matching posts.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@param			since	query		string	false	"Since (RFC 3339 or 2006-01-02 15:04:05)"
+//	@param			until	query		string	false	"Until (RFC 3339 or 2006-01-02 15:04:05)"
+//	@param			limit	query		int		false	"Limit"
+//	@param			offset	query		int		false	"Offset, can't be combined with cursor"
+//	@param			cursor	query		string	false	"Cursor, the next_cursor of the previous page"
+//	@param			sort	query		string	false	"Sort (asc, desc, top, hot or trending)"
+//	@param			tags	query		string	false	"Comma separated tags, posts must have all of them"
+//	@param			search	query		string	false	"Search in title and content"
+//	@success		200		{object}	[]store.PostWithMetadata
+//	@failure		400		{object}	error
+//	@failure		404		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/posts	[get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	feedQuery, err := readFeedQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	author, err := app.getUser(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	posts, next, err := app.store.Post.GetPostsByUser(ctx, author.ID, user.ID, feedQuery)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonPaginatedResponse(w, http.StatusOK, posts, next); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -60,13 +286,15 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 // Follow User godoc
 //
 //	@summary		Follows a user
-//	@description	Follows a user by ID
+//	@description	Follows a user by ID. Following a private account files a follow request it has to approve.
 //	@tags			users
 //	@accept			json
 //	@produce		json
 //	@param			userID	path		int		true	"User ID"
+//	@success		202		{string}	string	"Follow requested"
 //	@success		204		{string}	string	"User followed"
-//	@failure		400		{object}	error
+//	@failure		400		{object}	error	"Following yourself"
+//	@failure		403		{object}	error	"Blocked"
 //	@failure		404		{object}	error	"User not found"
 //	@failure		500		{object}	error
 //	@security		ApiKeyAuth
@@ -80,17 +308,21 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := app.store.User.FollowUser(r.Context(), user.ID, payload.UserID); err != nil {
-		switch err {
-		case store.ErrorUserFollowConflict:
-			app.conflictResponse(w, r, err)
-			return
-		default:
+	pending, err := app.store.User.FollowUser(r.Context(), user.ID, payload.UserID)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if pending {
+		if err := jsonResponse(w, http.StatusAccepted, nil); err != nil {
 			app.internalServerError(w, r, err)
-			return
 		}
+		return
 	}
 
+	app.invalidateTimeline(r.Context(), user.ID)
+
 	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -99,14 +331,14 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 // Unfollow User godoc
 //
 //	@summary		Unfollows a user
-//	@description	Unfollows a user by ID
+//	@description	Unfollows a user by ID or cancels the pending request to follow them
 //	@tags			users
 //	@accept			json
 //	@produce		json
 //	@param			userID	path		int		true	"User ID"
 //	@success		204		{string}	string	"User unfollowed"
 //	@failure		400		{object}	error
-//	@failure		404		{object}	error	"User not found"
+//	@failure		409		{object}	error	"Not following the user"
 //	@failure		500		{object}	error
 //	@security		ApiKeyAuth
 //	@router			/users/{id}/unfollow	[put]
@@ -120,21 +352,62 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err := app.store.User.UnFollowUser(r.Context(), user.ID, payload.UserID); err != nil {
-		switch err {
-		case store.ErrorNotFound:
-			app.conflictResponse(w, r, store.ErrorUserUnFollowConflict)
-			return
-		default:
-			app.internalServerError(w, r, err)
-			return
+		if errors.Is(err, store.ErrorNotFound) {
+			err = store.ErrorUserUnFollowConflict
 		}
+		app.storeErrorResponse(w, r, err)
+		return
 	}
 
+	app.invalidateTimeline(r.Context(), user.ID)
+
 	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
 
+// GetFollowSuggestions godoc
+//
+//	@summary		Suggests users to follow
+//	@description	Suggests the users followed by the users the caller follows. Those following the caller come first, then the ones with the most mutuals.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			limit	query		int	false	"Limit"
+//	@success		200		{object}	[]store.Suggestion
+//	@failure		400		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/suggestions	[get]
+func (app *application) getFollowSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	sq := SuggestionQueryAPi{
+		Limit: 10,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	suggestions, err := app.store.User.GetFollowSuggestions(r.Context(), user.ID, sq.Limit)
+	if err != nil {
+		app.storeErrorResponse(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
 func getUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userContextKey).(*store.User)
 	return user
@@ -169,3 +442,124 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.internalServerError(w, r, err)
 	}
 }
+
+// RevokeUserSessions godoc
+//
+//	@summary		Revokes all sessions of a user
+//	@description	Revokes every access and refresh token issued to the user so far
+//	@tags			users
+//	@produce		json
+//	@param			userID	path		int		true	"User ID"
+//	@success		204		{string}	string	"Sessions revoked"
+//	@failure		400		{object}	error
+//	@failure		403		{object}	error
+//	@failure		500		{object}	error
+//	@security		ApiKeyAuth
+//	@router			/users/{userID}/sessions [delete]
+func (app *application) revokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.revokeAllSessions(r.Context(), userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// ResendActivation godoc
+//
+//	@summary		Resends the activation email
+//	@description	Sends a new invitation token to a user that hasn't activated the account yet. Previous tokens stop working.
+//	@tags			users
+//	@accept			json
+//	@produce		json
+//	@param			payload	body		ResendActivationPayload	true	"User email"
+//	@success		202		{string}	string					"Activation email sent if the user is pending"
+//	@failure		400		{object}	error
+//	@failure		429		{object}	error
+//	@failure		500		{object}	error
+//	@router			/users/activate/resend [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// emails are case insensitive, the limiter and the store see the same address
+	address := strings.ToLower(payload.Email)
+
+	// limited per email on top of the per ip limiter so an address can't be flooded
+	if app.config.emailRateLimiter.Enabled {
+		if allow, retryAfter := app.emailRateLimiter.Allow(address); !allow {
+			app.rateLimiteExceedResponse(w, r, retryAfter.String())
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.User.GetPendingUserByEmail(ctx, address)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			// don't let the caller find out which emails are registered
+			if err := jsonResponse(w, http.StatusAccepted, nil); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	token := uuid.New().String()
+
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString(hash[:])
+
+	email, err := app.newInvitationEmail(user, token)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.User.RotateInvitation(ctx, user.ID, hashToken, app.config.mail.expiry, email); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) newInvitationEmail(user *store.User, token string) (*store.Email, error) {
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, token)
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: activationURL,
+	}
+
+	return store.NewEmail(mailer.UserWelcomeTemplate, user.Username, user.Email, user.Locale, vars)
+}
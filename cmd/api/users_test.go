@@ -1,9 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/ratelimiter"
+	"github.com/Martins-Iroka/social/internal/store"
 )
 
 // refer to testify github for testing
@@ -40,4 +47,75 @@ func TestGetUser(t *testing.T) {
 		checkResponseCode(t, http.StatusOK, rr.Code)
 
 	})
+
+	t.Run("should not expose how a user is secured", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/"+strconv.FormatInt(store.MockAdminID, 10), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res struct {
+			Data struct {
+				MFAEnabled *bool `json:"mfa_enabled"`
+				Role       struct {
+					Name        string    `json:"name"`
+					Permissions *[]string `json:"permissions"`
+				} `json:"role"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Data.MFAEnabled != nil || res.Data.Role.Permissions != nil {
+			t.Errorf("expected no mfa_enabled and role permissions; got %+v", res.Data)
+		}
+
+		if res.Data.Role.Name != "admin" {
+			t.Errorf("expected the role name; got %q", res.Data.Role.Name)
+		}
+	})
+}
+
+func TestResendActivation(t *testing.T) {
+	cfg := config{
+		emailRateLimiter: ratelimiter.Config{
+			RequestsPerTimeFrame: 2,
+			TimeFrame:            time.Hour,
+			Enabled:              true,
+			MaxKeys:              10,
+		},
+	}
+
+	app := newTestApplication(t, cfg)
+	mux := app.mount()
+
+	send := func(email string) int {
+		body := strings.NewReader(`{"email": "` + email + `"}`)
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/activate/resend", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should rate limit per email", func(t *testing.T) {
+		for range cfg.emailRateLimiter.RequestsPerTimeFrame {
+			checkResponseCode(t, http.StatusAccepted, send("pending@example.com"))
+		}
+
+		checkResponseCode(t, http.StatusTooManyRequests, send("Pending@example.com"))
+		checkResponseCode(t, http.StatusAccepted, send("other@example.com"))
+	})
+
+	t.Run("should validate the email", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, send("not-an-email"))
+	})
 }
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti varchar(64) PRIMARY KEY,
+    user_id bigint NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- tokens issued to the user at or before revoked_at are no longer accepted
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id bigint PRIMARY KEY,
+    revoked_at timestamp with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id bigserial PRIMARY KEY,
+    template varchar(255) NOT NULL,
+    username varchar(255) NOT NULL,
+    email citext NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status varchar(16) NOT NULL DEFAULT 'pending', -- pending, sent or dead
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    last_error text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    sent_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox (next_attempt_at) WHERE status = 'pending';
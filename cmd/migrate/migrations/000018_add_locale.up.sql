@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT 'en';
+
+ALTER TABLE email_outbox ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT 'en';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_comments_parent_id_created_at;
+ALTER TABLE comments DROP COLUMN parent_id;
\ No newline at end of file
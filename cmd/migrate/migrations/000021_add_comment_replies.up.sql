@@ -0,0 +1,2 @@
+ALTER TABLE comments ADD COLUMN parent_id bigint REFERENCES comments (id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id_created_at ON comments (parent_id, created_at, id);
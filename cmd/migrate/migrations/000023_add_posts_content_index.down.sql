@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_posts_content;
\ No newline at end of file
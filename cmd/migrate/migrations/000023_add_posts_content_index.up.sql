@@ -0,0 +1,2 @@
+-- search matches the content as well as the title (idx_posts_title)
+CREATE INDEX IF NOT EXISTS idx_posts_content ON posts USING gin (content gin_trgm_ops);
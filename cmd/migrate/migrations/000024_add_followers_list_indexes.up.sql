@@ -0,0 +1,3 @@
+-- page the followers and the following of a user newest first
+CREATE INDEX IF NOT EXISTS idx_followers_user_id_created_at ON followers (user_id, created_at, follower_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id_created_at ON followers (follower_id, created_at, user_id);
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id bigint NOT NULL,
+    permission_id bigint NOT NULL,
+
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description) VALUES
+    ('posts:update:any', 'Update the posts of other users'),
+    ('posts:delete:any', 'Delete the posts of other users'),
+    ('comments:update:any', 'Update the comments of other users'),
+    ('comments:moderate', 'Delete the comments of other users'),
+    ('users:sessions:revoke', 'Revoke every session of a user'),
+    ('roles:manage', 'Create and modify roles and assign them to users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON (r.name, p.name) IN (
+    ('moderator', 'posts:update:any'),
+    ('moderator', 'comments:moderate'),
+    ('admin', 'posts:update:any'),
+    ('admin', 'posts:delete:any'),
+    ('admin', 'comments:update:any'),
+    ('admin', 'comments:moderate'),
+    ('admin', 'users:sessions:revoke'),
+    ('admin', 'roles:manage')
+);
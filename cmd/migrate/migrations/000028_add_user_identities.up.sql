@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider varchar(50) NOT NULL,
+    subject varchar(255) NOT NULL,
+    user_id bigint NOT NULL,
+    email citext,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (provider, subject),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state bytea PRIMARY KEY,
+    provider varchar(50) NOT NULL,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE refresh_tokens DROP COLUMN amr;
+ALTER TABLE roles DROP COLUMN mfa_required;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+ALTER TABLE users DROP COLUMN totp_last_counter, DROP COLUMN totp_enabled, DROP COLUMN totp_secret;
\ No newline at end of file
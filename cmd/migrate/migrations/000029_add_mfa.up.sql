@@ -0,0 +1,20 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret TEXT,
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_counter BIGINT;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id bigint NOT NULL,
+    code bytea NOT NULL,
+    used_at timestamp(0) with time zone,
+
+    PRIMARY KEY (user_id, code),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE roles ADD COLUMN mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE roles SET mfa_required = TRUE WHERE name IN ('moderator', 'admin');
+
+-- how the session was authenticated, carried over to every refreshed access token
+ALTER TABLE refresh_tokens ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{}';
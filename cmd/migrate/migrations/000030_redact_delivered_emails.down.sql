@@ -0,0 +1 @@
+-- the redacted template data can't be restored
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- the template data of an email carries the one-time tokens of its links,
+-- it's redacted once the email is sent or dead lettered
+UPDATE email_outbox SET data = '{}' WHERE status IN ('sent', 'dead');
@@ -18,6 +18,7 @@ func main() {
 
 	defer conn.Close()
 
-	store := store.NewPostgresStorage(conn)
+	// the seed doesn't enroll anyone in two-factor authentication
+	store := store.NewPostgresStorage(conn, nil)
 	db.Seed(store, conn)
 }
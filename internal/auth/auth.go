@@ -7,4 +7,6 @@ import (
 type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
+	GenerateRefreshToken() (string, error)
+	JWKS() JWKS
 }
@@ -1,28 +1,65 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// the secret should be stored in environment variables
+var ErrNoSigningKey = errors.New("the first key has to be able to sign")
+
+// JWTAuthenticator signs with its first key and validates with any of them,
+// the key being picked by the kid header of the token.
 type JWTAuthenticator struct {
-	secret string
-	aud    string
-	iss    string
+	signing *Key
+	keys    map[string]*Key
+	methods []string
+	aud     string
+	iss     string
 }
 
-func NewJWTAuthenticator(secret, aud, iss string) *JWTAuthenticator {
-	return &JWTAuthenticator{
-		secret, iss, aud,
+// NewJWTAuthenticator takes the signing key first, then the keys of previous
+// rotations that only validate the tokens they signed. A key with an empty
+// ID validates the tokens issued without a kid.
+func NewJWTAuthenticator(aud, iss string, signing *Key, previous ...*Key) (*JWTAuthenticator, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, ErrNoSigningKey
+	}
+
+	a := &JWTAuthenticator{
+		signing: signing,
+		keys:    map[string]*Key{},
+		aud:     aud,
+		iss:     iss,
+	}
+
+	seen := map[string]bool{}
+	for _, k := range append([]*Key{signing}, previous...) {
+		if _, ok := a.keys[k.id]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", k.id)
+		}
+		a.keys[k.id] = k
+
+		if alg := k.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			a.methods = append(a.methods, alg)
+		}
 	}
+
+	return a, nil
 }
 
 func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(a.signing.method, claims)
+	if a.signing.id != "" {
+		token.Header["kid"] = a.signing.id
+	}
 
-	tokenString, err := token.SignedString([]byte(a.secret))
+	tokenString, err := token.SignedString(a.signing.sign)
 	if err != nil {
 		return "", err
 	}
@@ -32,14 +69,68 @@ func (a *JWTAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
 
 func (a *JWTAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 	return jwt.Parse(token, func(t *jwt.Token) (any, error) { // refer to Parse doc
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := t.Header["kid"].(string)
+
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+
+		// a token can't pick the algorithm its key is used with
+		if t.Method.Alg() != key.method.Alg() {
 			return nil, fmt.Errorf("unexpected siging method %v", t.Header["alg"])
 		}
 
-		return []byte(a.secret), nil
+		return key.verify, nil
 	},
 		jwt.WithExpirationRequired(),
 		jwt.WithAudience(a.aud),
-		jwt.WithIssuer(a.aud),
-		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods(a.methods))
+}
+
+// JWKS publishes the public keys so other services can verify our tokens.
+// HMAC secrets are left out.
+func (a *JWTAuthenticator) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	// the signing key first, then the others in a stable order
+	if jwk, ok := a.signing.jwk(); ok {
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	for _, id := range sortedIDs(a.keys) {
+		if id == a.signing.id {
+			continue
+		}
+		if jwk, ok := a.keys[id].jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+func sortedIDs(keys map[string]*Key) []string {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// refresh tokens are opaque, only the hash is persisted so they don't need to be a JWT
+func (a *JWTAuthenticator) GenerateRefreshToken() (string, error) {
+	return RandomToken()
+}
+
+// RandomToken is 32 random bytes, base64url encoded.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func claimsFor(aud, iss string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": int64(42),
+		"aud": aud,
+		"iss": iss,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+}
+
+// writePEM stores key as a PKCS#8 private key, or a PKIX public key, and
+// returns the path.
+func writePEM(t *testing.T, key any) string {
+	t.Helper()
+
+	var block *pem.Block
+	switch key.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := LoadKey("rsa-1", writePEM(t, newRSAKey(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edKey, err := LoadKey("ed-1", writePEM(t, newEd25519Key(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []*Key{NewHMACKey("hs-1", "secret"), rsaKey, edKey} {
+		t.Run("should round trip a "+key.method.Alg()+" token", func(t *testing.T) {
+			a, err := NewJWTAuthenticator("aud", "iss", key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := a.GenerateToken(claimsFor("aud", "iss"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("expected the token to validate, got %v", err)
+			}
+
+			if kid := parsed.Header["kid"]; kid != key.ID() {
+				t.Errorf("expected kid %q, got %v", key.ID(), kid)
+			}
+		})
+	}
+
+	t.Run("should check the audience and the issuer separately", func(t *testing.T) {
+		a, err := NewJWTAuthenticator("aud", "iss", rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, claims := range []jwt.MapClaims{claimsFor("iss", "iss"), claimsFor("aud", "aud")} {
+			token, err := a.GenerateToken(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := a.ValidateToken(token); err == nil {
+				t.Errorf("expected aud=%v iss=%v to be rejected", claims["aud"], claims["iss"])
+			}
+		}
+	})
+
+	t.Run("should validate tokens of a previous key after a rotation", func(t *testing.T) {
+		old, err := NewJWTAuthenticator("aud", "iss", rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := old.GenerateToken(claimsFor("aud", "iss"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only the public half of the old key is kept
+		pub, err := LoadKey("rsa-1", writePEM(t, rsaKey.verify))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rotated, err := NewJWTAuthenticator("aud", "iss", edKey, pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := rotated.ValidateToken(token); err != nil {
+			t.Errorf("expected the old token to validate, got %v", err)
+		}
+
+		without, err := NewJWTAuthenticator("aud", "iss", edKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := without.ValidateToken(token); err == nil {
+			t.Error("expected a token of a dropped key to be rejected")
+		}
+	})
+
+	t.Run("should reject a token signed with another algorithm than its key", func(t *testing.T) {
+		a, err := NewJWTAuthenticator("aud", "iss", rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// HS256 with the RSA public key as the secret
+		der, err := x509.MarshalPKIXPublicKey(rsaKey.verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("aud", "iss"))
+		forged.Header["kid"] = "rsa-1"
+		token, err := forged.SignedString(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ValidateToken(token); err == nil {
+			t.Error("expected the forged token to be rejected")
+		}
+	})
+
+	t.Run("should not sign with a public key", func(t *testing.T) {
+		pub, err := LoadKey("pub", writePEM(t, edKey.verify))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewJWTAuthenticator("aud", "iss", pub); err != ErrNoSigningKey {
+			t.Errorf("expected ErrNoSigningKey, got %v", err)
+		}
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := NewKey("rsa-1", newRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edKey, err := NewKey("ed-1", newEd25519Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := NewJWTAuthenticator("aud", "iss", edKey, rsaKey, NewHMACKey("", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := a.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected the two public keys, got %d", len(set.Keys))
+	}
+
+	if k := set.Keys[0]; k.Kid != "ed-1" || k.Kty != "OKP" || k.Crv != "Ed25519" || k.Alg != "EdDSA" || k.X == "" {
+		t.Errorf("unexpected signing key %+v", k)
+	}
+
+	if k := set.Keys[1]; k.Kid != "rsa-1" || k.Kty != "RSA" || k.Alg != "RS256" || k.N == "" || k.E != "AQAB" {
+		t.Errorf("unexpected rotated key %+v", k)
+	}
+}
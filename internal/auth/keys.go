@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported key, expected an RSA or Ed25519 key")
+
+// Key is a key identified by its kid. Keys loaded from a public key can only
+// verify tokens, which is how the keys of a rotation are kept around until
+// the tokens they signed expire.
+type Key struct {
+	id     string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+func (k *Key) ID() string {
+	return k.id
+}
+
+// CanSign is false for keys loaded from a public key.
+func (k *Key) CanSign() bool {
+	return k.sign != nil
+}
+
+// NewHMACKey is a HS256 shared secret. It's never published in the JWKS.
+func NewHMACKey(id, secret string) *Key {
+	return &Key{
+		id:     id,
+		method: jwt.SigningMethodHS256,
+		sign:   []byte(secret),
+		verify: []byte(secret),
+	}
+}
+
+// LoadKey reads a PEM file, see ParseKey.
+func LoadKey(id, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(id, data)
+}
+
+// ParseKey parses a PEM encoded RSA (RS256) or Ed25519 (EdDSA) key. Private
+// keys may be PKCS#8 or PKCS#1, public keys PKIX.
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: no PEM data found", id)
+	}
+
+	var parsed any
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unexpected PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	return NewKey(id, parsed)
+}
+
+// NewKey wraps an *rsa.PrivateKey, *rsa.PublicKey, ed25519.PrivateKey or
+// ed25519.PublicKey.
+func NewKey(id string, parsed any) (*Key, error) {
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{id: id, method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{id: id, method: jwt.SigningMethodRS256, verify: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{id: id, method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public().(ed25519.PublicKey)}, nil
+	case ed25519.PublicKey:
+		return &Key{id: id, method: jwt.SigningMethodEdDSA, verify: k}, nil
+	default:
+		return nil, fmt.Errorf("key %s: %w", id, ErrUnsupportedKey)
+	}
+}
+
+// JWK is the public half of a key as published in a JWKS (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// key turns a published RSA or Ed25519 key back into a verify only Key.
+func (j JWK) key() (*Key, error) {
+	switch {
+	case j.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(j.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: bad Ed25519 key size", j.Kid)
+		}
+		return NewKey(j.Kid, ed25519.PublicKey(x))
+	default:
+		return nil, fmt.Errorf("key %s: %w", j.Kid, ErrUnsupportedKey)
+	}
+}
+
+// jwk returns false for the keys that can't be published (HMAC secrets).
+func (k *Key) jwk() (JWK, bool) {
+	jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+
+	switch pub := k.verify.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
@@ -13,12 +13,19 @@ var testClaims = jwt.MapClaims{
 	"iss": "test-aud",
 	"sub": int64(42),
 	"exp": time.Now().Add(time.Hour).Unix(),
+	"iat": time.Now().Unix(),
+	"jti": "test-jti",
 }
 
 type TestAuthenticator struct{}
 
+// GenerateToken signs claims, or the claims of user 42 when they're nil.
 func (t *TestAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims)
+	if claims == nil {
+		claims = testClaims
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secret))
 }
 
@@ -27,3 +34,11 @@ func (t *TestAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
 		return []byte(secret), nil
 	})
 }
+
+func (t *TestAuthenticator) GenerateRefreshToken() (string, error) {
+	return RandomToken()
+}
+
+func (t *TestAuthenticator) JWKS() JWKS {
+	return JWKS{Keys: []JWK{}}
+}
@@ -0,0 +1,136 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/Martins-Iroka/social/internal/auth"
+	"github.com/Martins-Iroka/social/internal/auth/oidctest"
+)
+
+const redirectURL = "http://localhost:8080/v1/authentication/oidc/fake/callback"
+
+func newFakeProvider(t *testing.T) (*oidctest.Provider, *auth.OIDCProvider) {
+	t.Helper()
+
+	idp, err := oidctest.NewProvider("client-id", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	p := auth.NewOIDCProvider("fake", auth.OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  redirectURL,
+	}, idp.Client())
+
+	return idp, p
+}
+
+// login runs the flow up to the callback and returns the code and state.
+func login(t *testing.T, idp *oidctest.Provider, p *auth.OIDCProvider, nonce, challenge string) (string, string) {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), "the-state", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback, err := idp.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.Query().Get("code"), u.Query().Get("state")
+}
+
+func TestOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should log in with a valid code, verifier and nonce", func(t *testing.T) {
+		idp, p := newFakeProvider(t)
+
+		verifier, challenge, err := auth.NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, state := login(t, idp, p, "the-nonce", challenge)
+		if state != "the-state" {
+			t.Errorf("expected the state back, got %q", state)
+		}
+
+		identity, err := p.Exchange(ctx, code, verifier, "the-nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if identity.Subject != idp.Subject || identity.Email != idp.Email || !identity.EmailVerified {
+			t.Errorf("unexpected identity %+v", identity)
+		}
+	})
+
+	t.Run("should reject a wrong code verifier", func(t *testing.T) {
+		idp, p := newFakeProvider(t)
+
+		_, challenge, err := auth.NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other, _, err := auth.NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _ := login(t, idp, p, "the-nonce", challenge)
+
+		if _, err := p.Exchange(ctx, code, other, "the-nonce"); err == nil {
+			t.Error("expected the exchange to fail")
+		}
+	})
+
+	t.Run("should reject a replayed id token nonce", func(t *testing.T) {
+		idp, p := newFakeProvider(t)
+
+		verifier, challenge, err := auth.NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _ := login(t, idp, p, "the-nonce", challenge)
+
+		if _, err := p.Exchange(ctx, code, verifier, "another-nonce"); !errors.Is(err, auth.ErrInvalidIDToken) {
+			t.Errorf("expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("should not accept a code twice", func(t *testing.T) {
+		idp, p := newFakeProvider(t)
+
+		verifier, challenge, err := auth.NewPKCE()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _ := login(t, idp, p, "the-nonce", challenge)
+
+		if _, err := p.Exchange(ctx, code, verifier, "the-nonce"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := p.Exchange(ctx, code, verifier, "the-nonce"); err == nil {
+			t.Error("expected the second exchange to fail")
+		}
+	})
+
+}
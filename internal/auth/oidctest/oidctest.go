@@ -0,0 +1,207 @@
+// Package oidctest is an in-process OpenID Connect provider to test the login
+// flow against. It implements just enough of the authorization code flow with
+// PKCE: discovery, the authorize and token endpoints and the keys.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+}
+
+// Provider logs in whoever Subject, Email and EmailVerified describe.
+type Provider struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	Subject       string
+	Email         string
+	EmailVerified bool
+
+	signer *auth.JWTAuthenticator
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// NewProvider starts the provider, Close it when done.
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		Subject:       "fake-subject",
+		Email:         "gopher@example.com",
+		EmailVerified: true,
+		codes:         map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /keys", p.keys)
+	p.Server = httptest.NewServer(mux)
+
+	key, err := auth.NewKey("fake-key", priv)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	// only GenerateToken and JWKS are used, the audience is per token
+	p.signer, err = auth.NewJWTAuthenticator(clientID, p.URL, key)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Authorize plays the user logging in at authURL, the provider's authorize
+// endpoint, and returns the URL the user is sent back to.
+func (p *Provider) Authorize(authURL string) (string, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		return "", fmt.Errorf("authorize: unexpected status %d", res.StatusCode)
+	}
+
+	return res.Header.Get("Location"), nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/keys",
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.ClientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := rand.Text()
+
+	p.mu.Lock()
+	p.codes[code] = grant{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+	}
+	p.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	if id, secret, _ := r.BasicAuth(); id != url.QueryEscape(p.ClientID) || secret != url.QueryEscape(p.ClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// codes are single use
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		g.redirectURI != r.PostForm.Get("redirect_uri") || g.challenge != challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := p.signer.GenerateToken(jwt.MapClaims{
+		"iss":            p.URL,
+		"sub":            p.Subject,
+		"aud":            g.clientID,
+		"exp":            time.Now().Add(time.Minute * 5).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          g.nonce,
+		"email":          p.Email,
+		"email_verified": p.EmailVerified,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, p.signer.JWKS())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
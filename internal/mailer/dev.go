@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+// DevMailer never talks to the network. It renders the email and writes it as
+// an .eml file to dir, or to the log when dir is empty.
+type DevMailer struct {
+	fromEmail string
+	dir       string
+}
+
+func NewDevMailer(dir, fromEmail string) (*DevMailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DevMailer{
+		fromEmail: fromEmail,
+		dir:       dir,
+	}, nil
+}
+
+func (m *DevMailer) Send(templateFile, username, email, locale string, data any, isSandBox bool) error {
+	//template parsing and building
+	rendered, err := parseTemplate(templateFile, locale, data)
+	if err != nil {
+		return err
+	}
+
+	message := gomail.NewMessage()
+	message.SetAddressHeader("From", m.fromEmail, FromName)
+	message.SetAddressHeader("To", email, username)
+	message.SetHeader("Subject", rendered.subject)
+
+	setBody(message, rendered)
+
+	if m.dir == "" {
+		var eml bytes.Buffer
+		if _, err := message.WriteTo(&eml); err != nil {
+			return err
+		}
+		log.Printf("Email - %v not sent (dev mailer):\n%s", email, eml.String())
+		return nil
+	}
+
+	name := fmt.Sprintf("%d-%s-%s.eml", time.Now().UnixNano(), strings.TrimSuffix(templateFile, filepath.Ext(templateFile)), email)
+	path := filepath.Join(m.dir, filepath.Base(name))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := message.WriteTo(f); err != nil {
+		return err
+	}
+
+	log.Printf("Email - %v written to %v", email, path)
+	return nil
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDevMailer(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewDevMailer(dir, "hello@gophersocial.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      "gopher",
+		ActivationURL: "http://localhost:4000/confirm/token",
+	}
+
+	if err := m.Send(UserWelcomeTemplate, "gopher", "gopher@example.com", "", vars, true); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected 1 .eml file; got %d", len(files))
+	}
+
+	eml, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"To: \"gopher\" <gopher@example.com>", "Finish Registration with GopherSocial", vars.ActivationURL} {
+		if !strings.Contains(string(eml), want) {
+			t.Errorf("expected the email to contain %q", want)
+		}
+	}
+}
@@ -5,54 +5,105 @@ import (
 	"embed"
 	"fmt"
 	"html/template"
-	"log"
-	"time"
+	"io/fs"
+	"path"
+	"strings"
+	textTemplate "text/template"
+
+	gomail "gopkg.in/mail.v2"
 )
 
 const (
-	FromName            = "GopherSocial"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName              = "GopherSocial"
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
 )
 
 //go:embed "template"
 var FS embed.FS
 
 type Client interface {
-	Send(templateFile, username, email string, data any, isSandBox bool) error
+	Send(templateFile, username, email, locale string, data any, isSandBox bool) error
+}
+
+// email is a rendered template. text is empty when the template has no "text" block.
+type email struct {
+	subject string
+	html    string
+	text    string
 }
 
-func parseTemplate(templateFile string, data any) (*bytes.Buffer, *bytes.Buffer, error) {
-	tmpl, error := template.ParseFS(FS, "template/"+templateFile)
-	if error != nil {
-		return nil, nil, error
+// parseTemplate renders the template for the locale, see resolveTemplate.
+func parseTemplate(templateFile, locale string, data any) (*email, error) {
+	tmpl, err := template.ParseFS(FS, "template/"+resolveTemplate(templateFile, locale))
+	if err != nil {
+		return nil, err
 	}
+
 	subject := new(bytes.Buffer)
-	err := tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return nil, nil, error
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
 	}
+
 	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
-	if err != nil {
-		return nil, nil, error
+	if err := tmpl.ExecuteTemplate(body, "body", data); err != nil {
+		return nil, err
 	}
 
-	return subject, body, nil
+	rendered := &email{
+		subject: strings.TrimSpace(subject.String()),
+		html:    body.String(),
+	}
+
+	// the plain text alternative is optional, and html/template escaping is wrong for it
+	if tmpl.Lookup("text") != nil {
+		textTmpl, err := textTemplate.ParseFS(FS, "template/"+resolveTemplate(templateFile, locale))
+		if err != nil {
+			return nil, err
+		}
+
+		text := new(bytes.Buffer)
+		if err := textTmpl.ExecuteTemplate(text, "text", data); err != nil {
+			return nil, err
+		}
+		rendered.text = strings.TrimSpace(text.String())
+	}
+
+	return rendered, nil
 }
 
-func handleRetries(email string, fn func() error) error {
-	for i := range maxRetries {
-		if err := fn(); err != nil {
-			log.Printf("Failed to send email to %v, attempt %d of %d", email, i+1, maxRetries)
-			log.Printf("Error: %v", err.Error())
+// resolveTemplate finds the most specific translation of templateFile, for
+// the locale "fr-CA" and "user_invitation.tmpl" it tries
+// "user_invitation.fr-ca.tmpl", then "user_invitation.fr.tmpl" and falls
+// back to "user_invitation.tmpl".
+func resolveTemplate(templateFile, locale string) string {
+	ext := path.Ext(templateFile)
+	name := strings.TrimSuffix(templateFile, ext)
+
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	for locale != "" {
+		candidate := fmt.Sprintf("%s.%s%s", name, locale, ext)
+		if _, err := fs.Stat(FS, "template/"+candidate); err == nil {
+			return candidate
+		}
 
-			// exponential backoff which delays for period before send a mail again in case an error occurs.
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
 		}
-		return nil
+		locale = locale[:i]
+	}
+
+	return templateFile
+}
+
+// setBody adds the html body and, if there's one, the plain text alternative.
+func setBody(message *gomail.Message, e *email) {
+	if e.text == "" {
+		message.SetBody("text/html", e.html)
+		return
 	}
 
-	return fmt.Errorf("failed to send email after %d attemps", maxRetries)
+	message.SetBody("text/plain", e.text)
+	message.AddAlternative("text/html", e.html)
 }
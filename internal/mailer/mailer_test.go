@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveTemplate(t *testing.T) {
+	tests := []struct {
+		locale   string
+		expected string
+	}{
+		{"", "user_invitation.tmpl"},
+		{"en", "user_invitation.tmpl"},
+		{"fr", "user_invitation.fr.tmpl"},
+		{"fr-CA", "user_invitation.fr.tmpl"},
+		{"FR_ca", "user_invitation.fr.tmpl"},
+		{"de", "user_invitation.tmpl"},
+	}
+
+	for _, tt := range tests {
+		if got := resolveTemplate(UserWelcomeTemplate, tt.locale); got != tt.expected {
+			t.Errorf("locale %q: expected %v; got %v", tt.locale, tt.expected, got)
+		}
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	vars := map[string]any{
+		"Username":      "gopher",
+		"ActivationURL": "http://localhost:4000/confirm/token?a=1&b=2",
+	}
+
+	rendered, err := parseTemplate(UserWelcomeTemplate, "fr", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.subject != "Finalisez votre inscription à GopherSocial" {
+		t.Errorf("unexpected subject %q", rendered.subject)
+	}
+
+	// the plain text part must not be html escaped
+	if !strings.Contains(rendered.text, "token?a=1&b=2") {
+		t.Errorf("expected the text part to contain the raw url; got %q", rendered.text)
+	}
+
+	if !strings.Contains(rendered.html, "token?a=1&amp;b=2") {
+		t.Errorf("expected the html part to contain the escaped url; got %q", rendered.html)
+	}
+}
+
+func TestParsePasswordResetTemplate(t *testing.T) {
+	vars := map[string]any{
+		"Username":         "gopher",
+		"ResetURL":         "http://localhost:4000/reset-password/token",
+		"ExpiresInMinutes": 30,
+	}
+
+	for _, locale := range []string{"en", "fr"} {
+		rendered, err := parseTemplate(PasswordResetTemplate, locale, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(rendered.text, "30 minutes") {
+			t.Errorf("expected the %s email to give the expiry in minutes; got %q", locale, rendered.text)
+		}
+	}
+}
@@ -23,10 +23,9 @@ func NewMailTrapClient(apiKey, fromEmail string) (mailtrapClient, error) {
 	}, nil
 }
 
-func (m mailtrapClient) Send(templateFile, username, email string, data any, isSandbox bool) error {
-	//Template parsing and building
+func (m mailtrapClient) Send(templateFile, username, email, locale string, data any, isSandbox bool) error {
 	//template parsing and building
-	subject, body, err := parseTemplate(templateFile, data)
+	rendered, err := parseTemplate(templateFile, locale, data)
 	if err != nil {
 		return err
 	}
@@ -34,18 +33,15 @@ func (m mailtrapClient) Send(templateFile, username, email string, data any, isS
 	message := gomail.NewMessage()
 	message.SetHeader("From", "hello@demomailtrap.co")
 	message.SetHeader("To", "martdev17@gmail.com")
-	message.SetHeader("Subject", subject.String())
+	message.SetHeader("Subject", rendered.subject)
 
-	message.AddAlternative("text/html", body.String())
+	setBody(message, rendered)
 
 	dialer := gomail.NewDialer("live.smtp.mailtrap.io", 587, "api", m.apiKey)
-	err = handleRetries(email, func() error {
-		if err := dialer.DialAndSend(message); err != nil {
-			return err
-		}
-		log.Printf("Email - %v sent with status code %v", email, 200)
-		return nil
-	})
-
-	return err
+	if err := dialer.DialAndSend(message); err != nil {
+		return err
+	}
+	log.Printf("Email - %v sent with status code %v", email, 200)
+
+	return nil
 }
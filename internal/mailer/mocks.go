@@ -0,0 +1,7 @@
+package mailer
+
+type TestMailer struct{}
+
+func (m *TestMailer) Send(templateFile, username, email, locale string, data any, isSandBox bool) error {
+	return nil
+}
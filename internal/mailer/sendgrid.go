@@ -1,6 +1,7 @@
 package mailer
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/sendgrid/sendgrid-go"
@@ -24,18 +25,18 @@ func NewSendgrid(apiKey, fromEmail string) *SendGridMailer {
 	}
 }
 
-func (m *SendGridMailer) Send(templateFile, username, email string, data any, isSandBox bool) error {
+func (m *SendGridMailer) Send(templateFile, username, email, locale string, data any, isSandBox bool) error {
 	log.Printf("sandbox is %v", isSandBox)
 	from := mail.NewEmail(FromName, m.fromEmail)
 	to := mail.NewEmail(username, email)
 
 	//template parsing and building
-	subject, body, err := parseTemplate(templateFile, data)
+	rendered, err := parseTemplate(templateFile, locale, data)
 	if err != nil {
 		return err
 	}
 
-	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
+	message := mail.NewSingleEmail(from, rendered.subject, to, rendered.text, rendered.html)
 
 	message.SetMailSettings(
 		&mail.MailSettings{
@@ -45,31 +46,16 @@ func (m *SendGridMailer) Send(templateFile, username, email string, data any, is
 		},
 	)
 
-	// for i := range maxRetries {
-	// 	response, err := m.client.Send(message)
-	// 	if err != nil {
-	// 		log.Printf("Failed to send email to %v, attempt %d of %d", email, i+1, maxRetries)
-	// 		log.Printf("Error: %v", err.Error())
-
-	// 		// exponential backoff which delays for period before send a mail again in case an error occurs.
-	// 		time.Sleep(time.Second * time.Duration(i+1))
-	// 		continue
-	// 	}
-
-	// 	log.Printf("Email - %v sent with status code %v", email, response.StatusCode)
-	// 	return nil
-	// }
-
-	// return fmt.Errorf("failed to send email after %d attemps", maxRetries)
+	// failed sends are retried by the outbox, with backoff
+	response, err := m.client.Send(message)
+	if err != nil {
+		return err
+	}
 
-	err = handleRetries(email, func() error {
-		response, err := m.client.Send(message)
-		if err != nil {
-			return err
-		}
-		log.Printf("Email - %v sent with status code %v", email, response.StatusCode)
-		return nil
-	})
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("sendgrid responded with status code %d: %s", response.StatusCode, response.Body)
+	}
+	log.Printf("Email - %v sent with status code %v", email, response.StatusCode)
 
-	return err
+	return nil
 }
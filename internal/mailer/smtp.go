@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+
+	gomail "gopkg.in/mail.v2"
+)
+
+const (
+	SMTPSecurityStartTLS = "starttls"
+	// SMTPSecurityTLS is implicit tls, usually on port 465
+	SMTPSecurityTLS  = "tls"
+	SMTPSecurityNone = "none"
+
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// Security is one of starttls (default), tls or none
+	Security string
+	// Auth is plain or login, empty lets the server advertise it
+	Auth string
+}
+
+type SMTPMailer struct {
+	fromEmail string
+	dialer    *gomail.Dialer
+}
+
+func NewSMTPMailer(cfg SMTPConfig, fromEmail string) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+
+	dialer := gomail.NewDialer(cfg.Host, cfg.Port, cfg.Username, cfg.Password)
+	dialer.TLSConfig = &tls.Config{ServerName: cfg.Host}
+
+	switch cfg.Security {
+	case SMTPSecurityStartTLS, "":
+		dialer.SSL = false
+		dialer.StartTLSPolicy = gomail.MandatoryStartTLS
+	case SMTPSecurityTLS:
+		dialer.SSL = true
+	case SMTPSecurityNone:
+		dialer.SSL = false
+		dialer.StartTLSPolicy = gomail.NoStartTLS
+	default:
+		return nil, fmt.Errorf("unknown smtp security %q", cfg.Security)
+	}
+
+	if cfg.Username != "" {
+		switch cfg.Auth {
+		case SMTPAuthPlain:
+			dialer.Auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+		case SMTPAuthLogin:
+			dialer.Auth = &loginAuth{username: cfg.Username, password: cfg.Password}
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown smtp auth %q", cfg.Auth)
+		}
+	}
+
+	return &SMTPMailer{
+		fromEmail: fromEmail,
+		dialer:    dialer,
+	}, nil
+}
+
+// Send has no sandbox mode, point it to a local smtp server (e.g. mailpit) when developing.
+func (m *SMTPMailer) Send(templateFile, username, email, locale string, data any, isSandBox bool) error {
+	//template parsing and building
+	rendered, err := parseTemplate(templateFile, locale, data)
+	if err != nil {
+		return err
+	}
+
+	message := gomail.NewMessage()
+	message.SetAddressHeader("From", m.fromEmail, FromName)
+	message.SetAddressHeader("To", email, username)
+	message.SetHeader("Subject", rendered.subject)
+
+	setBody(message, rendered)
+
+	if err := m.dialer.DialAndSend(message); err != nil {
+		return err
+	}
+	log.Printf("Email - %v sent through %v", email, m.dialer.Host)
+
+	return nil
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp doesn't have.
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
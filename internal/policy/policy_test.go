@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCan(t *testing.T) {
+	moderator := Subject{UserID: 1, Permissions: []string{"posts:update:any", "comments:moderate"}}
+
+	tests := []struct {
+		name    string
+		subject Subject
+		perm    Permission
+		want    bool
+	}{
+		{"granted permission", moderator, PostsUpdateAny, true},
+		{"missing permission", moderator, PostsDeleteAny, false},
+		{"no permissions", Subject{UserID: 2}, CommentsModerate, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.subject.Can(tt.perm); got != tt.want {
+				t.Errorf("Can(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanOn(t *testing.T) {
+	user := Subject{UserID: 1}
+	admin := Subject{UserID: 2, Permissions: []string{"posts:delete:any"}}
+
+	t.Run("should let owners act on their own resources", func(t *testing.T) {
+		if !user.CanOn(1, PostsDeleteAny) {
+			t.Error("expected the owner to be allowed")
+		}
+	})
+
+	t.Run("should need the permission for someone else's resources", func(t *testing.T) {
+		if user.CanOn(2, PostsDeleteAny) {
+			t.Error("expected a user without the permission to be denied")
+		}
+
+		if !admin.CanOn(1, PostsDeleteAny) {
+			t.Error("expected a user with the permission to be allowed")
+		}
+	})
+
+	t.Run("should not treat an anonymous subject as the owner", func(t *testing.T) {
+		if (Subject{}).CanOn(0, PostsDeleteAny) {
+			t.Error("expected an anonymous subject to be denied")
+		}
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	moderator := Subject{UserID: 1, Permissions: []string{"comments:moderate"}, MFARequired: true}
+
+	t.Run("should require a second factor when the role asks for it", func(t *testing.T) {
+		if err := moderator.Authorize(CommentsModerate); !errors.Is(err, ErrMFARequired) {
+			t.Errorf("expected ErrMFARequired, got %v", err)
+		}
+
+		withMFA := moderator
+		withMFA.MFA = true
+		if err := withMFA.Authorize(CommentsModerate); err != nil {
+			t.Errorf("expected the session with a second factor to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("should deny before asking for a second factor", func(t *testing.T) {
+		if err := moderator.Authorize(RolesManage); !errors.Is(err, ErrDenied) {
+			t.Errorf("expected ErrDenied, got %v", err)
+		}
+	})
+
+	t.Run("should not require a second factor from owners", func(t *testing.T) {
+		if err := moderator.AuthorizeOn(1, CommentsModerate); err != nil {
+			t.Errorf("expected the owner to be allowed, got %v", err)
+		}
+	})
+}
+
+func TestKnown(t *testing.T) {
+	for _, p := range All {
+		if !Known(string(p)) {
+			t.Errorf("expected %s to be known", p)
+		}
+	}
+
+	if Known("posts:launch:any") {
+		t.Error("expected an unknown permission to be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+// Package ranking scores posts for the ranked feed orderings. Scores are
+// computed here rather than in SQL so the formulas can be tuned and tested
+// without a database.
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+type Mode string
+
+const (
+	// Top favours the most engaging posts of the last week, decaying slowly.
+	Top Mode = "top"
+	// Hot favours what's getting engagement right now, decaying fast.
+	Hot Mode = "hot"
+)
+
+// Signals are what a post is ranked on.
+type Signals struct {
+	Comments  int
+	Reactions int
+	// Interactions is how many times the viewer commented on or reacted to the
+	// author's posts, it's turned into the author affinity.
+	Interactions int
+	CreatedAt    time.Time
+}
+
+type Weights struct {
+	Comment  float64
+	Reaction float64
+	// Affinity is the most the author affinity can multiply a score by.
+	Affinity float64
+}
+
+var DefaultWeights = Weights{
+	Comment:  2,
+	Reaction: 1,
+	Affinity: 1,
+}
+
+const (
+	// topHalfLife is how long it takes a top score to halve
+	topHalfLife = time.Hour * 24 * 2
+	// hotGravity is how fast hot scores sink with age, the same as Hacker News
+	hotGravity = 1.8
+)
+
+// Window is how far back a mode looks for candidates.
+func (m Mode) Window() time.Duration {
+	switch m {
+	case Hot:
+		return time.Hour * 48
+	default:
+		return time.Hour * 24 * 7
+	}
+}
+
+// Affinity maps interactions to [0, 1): the first ones count the most.
+func Affinity(interactions int) float64 {
+	if interactions <= 0 {
+		return 0
+	}
+
+	return 1 - 1/(1+float64(interactions)/5)
+}
+
+// Score ranks a post at time now, higher first.
+func Score(m Mode, s Signals, w Weights, now time.Time) float64 {
+	engagement := w.Comment*float64(s.Comments) + w.Reaction*float64(s.Reactions)
+	boost := 1 + w.Affinity*Affinity(s.Interactions)
+
+	age := max(now.Sub(s.CreatedAt), 0)
+
+	switch m {
+	case Hot:
+		hours := age.Hours()
+		return (engagement + 1) * boost / math.Pow(hours+2, hotGravity)
+	default:
+		decay := math.Pow(0.5, float64(age)/float64(topHalfLife))
+		return (engagement + 1) * boost * decay
+	}
+}
@@ -0,0 +1,97 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("should rank more engagement higher at the same age", func(t *testing.T) {
+		for _, mode := range []Mode{Top, Hot} {
+			quiet := Signals{Comments: 1, Reactions: 2, CreatedAt: now.Add(-time.Hour)}
+			busy := Signals{Comments: 5, Reactions: 10, CreatedAt: now.Add(-time.Hour)}
+
+			if Score(mode, busy, DefaultWeights, now) <= Score(mode, quiet, DefaultWeights, now) {
+				t.Errorf("%s: expected the busier post to rank higher", mode)
+			}
+		}
+	})
+
+	t.Run("should decay with age", func(t *testing.T) {
+		for _, mode := range []Mode{Top, Hot} {
+			fresh := Signals{Comments: 3, Reactions: 3, CreatedAt: now.Add(-time.Hour)}
+			old := Signals{Comments: 3, Reactions: 3, CreatedAt: now.Add(-time.Hour * 72)}
+
+			if Score(mode, fresh, DefaultWeights, now) <= Score(mode, old, DefaultWeights, now) {
+				t.Errorf("%s: expected the fresh post to rank higher", mode)
+			}
+		}
+	})
+
+	t.Run("should halve a top score every half life", func(t *testing.T) {
+		s := Signals{Comments: 2, CreatedAt: now}
+		aged := s
+		aged.CreatedAt = now.Add(-topHalfLife)
+
+		got := Score(Top, aged, DefaultWeights, now) / Score(Top, s, DefaultWeights, now)
+		if got < 0.499 || got > 0.501 {
+			t.Errorf("expected a ratio of 0.5, got %v", got)
+		}
+	})
+
+	t.Run("should decay hot faster than top", func(t *testing.T) {
+		fresh := Signals{Reactions: 10, CreatedAt: now}
+		old := Signals{Reactions: 10, CreatedAt: now.Add(-time.Hour * 24)}
+
+		hot := Score(Hot, old, DefaultWeights, now) / Score(Hot, fresh, DefaultWeights, now)
+		top := Score(Top, old, DefaultWeights, now) / Score(Top, fresh, DefaultWeights, now)
+		if hot >= top {
+			t.Errorf("expected hot to keep less of its score than top, got %v >= %v", hot, top)
+		}
+	})
+
+	t.Run("should boost authors the viewer interacts with", func(t *testing.T) {
+		stranger := Signals{Comments: 2, CreatedAt: now.Add(-time.Hour)}
+		friend := stranger
+		friend.Interactions = 10
+
+		if Score(Hot, friend, DefaultWeights, now) <= Score(Hot, stranger, DefaultWeights, now) {
+			t.Error("expected the friend's post to rank higher")
+		}
+	})
+
+	t.Run("should rank posts without engagement by age", func(t *testing.T) {
+		newer := Signals{CreatedAt: now.Add(-time.Minute)}
+		older := Signals{CreatedAt: now.Add(-time.Hour)}
+
+		if Score(Hot, newer, DefaultWeights, now) <= Score(Hot, older, DefaultWeights, now) {
+			t.Error("expected the newer post to rank higher")
+		}
+	})
+
+	t.Run("should not reward posts from the future", func(t *testing.T) {
+		present := Signals{Comments: 1, CreatedAt: now}
+		future := Signals{Comments: 1, CreatedAt: now.Add(time.Hour)}
+
+		if Score(Hot, future, DefaultWeights, now) != Score(Hot, present, DefaultWeights, now) {
+			t.Error("expected clock skew to be clamped to age zero")
+		}
+	})
+}
+
+func TestAffinity(t *testing.T) {
+	if got := Affinity(0); got != 0 {
+		t.Errorf("expected no affinity without interactions, got %v", got)
+	}
+
+	prev := 0.0
+	for _, n := range []int{1, 5, 20, 1000} {
+		got := Affinity(n)
+		if got <= prev || got >= 1 {
+			t.Errorf("expected affinity to grow towards 1, got %v for %d interactions", got, n)
+		}
+		prev = got
+	}
+}
@@ -0,0 +1,76 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// BoundedFixedWindowLimiter is a fixed window limiter for keys callers pick,
+// like email addresses. Windows expire lazily instead of with a goroutine per
+// key, and at most maxKeys windows are tracked: when they're all in use the
+// oldest one is dropped to make room, so filling the limiter can't lock out
+// new keys.
+type BoundedFixedWindowLimiter struct {
+	sync.Mutex
+	windows map[string]*list.Element
+	// order holds the windows oldest first
+	order   *list.List
+	limit   int
+	window  time.Duration
+	maxKeys int
+}
+
+type window struct {
+	key   string
+	start time.Time
+	count int
+}
+
+func NewBoundedFixedWindowLimiter(limit int, duration time.Duration, maxKeys int) *BoundedFixedWindowLimiter {
+	return &BoundedFixedWindowLimiter{
+		windows: make(map[string]*list.Element),
+		order:   list.New(),
+		limit:   limit,
+		window:  duration,
+		maxKeys: maxKeys,
+	}
+}
+
+func (l *BoundedFixedWindowLimiter) Allow(key string) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	l.evictExpired(now)
+
+	e, exists := l.windows[key]
+	if !exists {
+		if len(l.windows) >= l.maxKeys {
+			l.remove(l.order.Front())
+		}
+
+		e = l.order.PushBack(&window{key: key, start: now})
+		l.windows[key] = e
+	}
+
+	w := e.Value.(*window)
+	if w.count >= l.limit {
+		return false, w.start.Add(l.window).Sub(now)
+	}
+
+	w.count++
+	return true, 0
+}
+
+// evictExpired drops the expired windows, they're all at the front.
+func (l *BoundedFixedWindowLimiter) evictExpired(now time.Time) {
+	for e := l.order.Front(); e != nil && now.Sub(e.Value.(*window).start) >= l.window; e = l.order.Front() {
+		l.remove(e)
+	}
+}
+
+func (l *BoundedFixedWindowLimiter) remove(e *list.Element) {
+	l.order.Remove(e)
+	delete(l.windows, e.Value.(*window).key)
+}
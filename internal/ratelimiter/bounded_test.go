@@ -0,0 +1,64 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoundedFixedWindowLimiter(t *testing.T) {
+	t.Run("should limit each key", func(t *testing.T) {
+		l := NewBoundedFixedWindowLimiter(2, time.Hour, 10)
+
+		for range 2 {
+			if allow, _ := l.Allow("a@example.com"); !allow {
+				t.Fatal("expected the request to be allowed")
+			}
+		}
+
+		if allow, retryAfter := l.Allow("a@example.com"); allow || retryAfter <= 0 {
+			t.Errorf("expected the request to be limited; got %v, %v", allow, retryAfter)
+		}
+
+		if allow, _ := l.Allow("b@example.com"); !allow {
+			t.Error("expected another key to be allowed")
+		}
+	})
+
+	t.Run("should evict the oldest key once full", func(t *testing.T) {
+		l := NewBoundedFixedWindowLimiter(1, time.Hour, 2)
+
+		l.Allow("a")
+		l.Allow("b")
+
+		if allow, _ := l.Allow("c"); !allow {
+			t.Error("expected a new key to be allowed")
+		}
+
+		if len(l.windows) != 2 {
+			t.Errorf("expected 2 tracked keys; got %d", len(l.windows))
+		}
+
+		if _, ok := l.windows["a"]; ok {
+			t.Error("expected the oldest key to be evicted")
+		}
+
+		if allow, _ := l.Allow("b"); allow {
+			t.Error("expected the remaining key to still be limited")
+		}
+	})
+
+	t.Run("should make room once windows expire", func(t *testing.T) {
+		l := NewBoundedFixedWindowLimiter(1, time.Millisecond, 1)
+
+		l.Allow("a")
+		time.Sleep(2 * time.Millisecond)
+
+		if allow, _ := l.Allow("b"); !allow {
+			t.Error("expected the expired window to be evicted")
+		}
+
+		if allow, _ := l.Allow("b"); allow {
+			t.Error("expected the new window to be limited")
+		}
+	})
+}
@@ -10,4 +10,6 @@ type Config struct {
 	RequestsPerTimeFrame int
 	TimeFrame            time.Duration
 	Enabled              bool
+	// MaxKeys caps the keys a BoundedFixedWindowLimiter tracks
+	MaxKeys int
 }
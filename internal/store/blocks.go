@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// BlockStore keeps the blocks and mutes between users. A block cuts every
+// interaction with the blocker, a mute only hides the muted user's posts from
+// the muter's feed.
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block is idempotent. The follows and follow requests between the two
+// users, in both directions, are removed with it.
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `
+			INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+			ON CONFLICT (blocker_id, blocked_id) DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM follow_requests
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Mute is idempotent.
+func (s *BlockStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	query := `
+		INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2)
+		ON CONFLICT (muter_id, muted_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *BlockStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	query := `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, muterID, mutedID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
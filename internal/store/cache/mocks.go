@@ -2,13 +2,16 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/Martins-Iroka/social/internal/store"
 )
 
 func NewMockStore() Storage {
 	return Storage{
-		User: &MockUserStore{},
+		User:        &MockUserStore{},
+		Revocations: &MockRevocationStore{},
+		Timelines:   &MockTimelineStore{},
 	}
 }
 
@@ -21,3 +24,47 @@ func (m MockUserStore) Get(ctx context.Context, id int64) (*store.User, error) {
 func (m MockUserStore) Set(ctx context.Context, user *store.User) error {
 	return nil
 }
+
+func (m MockUserStore) Delete(ctx context.Context, id int64) error {
+	return nil
+}
+
+type MockRevocationStore struct{}
+
+func (m MockRevocationStore) Get(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, bool, error) {
+	return false, false, nil
+}
+
+func (m MockRevocationStore) Set(ctx context.Context, jti string, revoked bool, ttl time.Duration) error {
+	return nil
+}
+
+func (m MockRevocationStore) SetUserCutoff(ctx context.Context, userID int64, revokedAt time.Time, ttl time.Duration) error {
+	return nil
+}
+
+type MockTimelineStore struct{}
+
+func (m MockTimelineStore) Get(ctx context.Context, userID, beforeID int64, limit int) (*TimelinePage, error) {
+	return nil, nil
+}
+
+func (m MockTimelineStore) Set(ctx context.Context, userID int64, postIDs []int64, complete bool, ttl time.Duration) error {
+	return nil
+}
+
+func (m MockTimelineStore) Push(ctx context.Context, postID int64, userIDs []int64, maxLen int) error {
+	return nil
+}
+
+func (m MockTimelineStore) Delete(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m MockTimelineStore) AddCelebrity(ctx context.Context, userID int64) error {
+	return nil
+}
+
+func (m MockTimelineStore) Celebrities(ctx context.Context) ([]int64, error) {
+	return []int64{}, nil
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+type RevocationStore struct {
+	rdb *redis.Client
+}
+
+// Get reports whether the token is revoked. found is false when nothing is
+// cached for it and the caller has to ask the database.
+func (s *RevocationStore) Get(ctx context.Context, jti string, userID int64, issuedAt time.Time) (revoked bool, found bool, err error) {
+	values, err := s.rdb.MGet(ctx, userCutoffKey(userID), tokenKey(jti)).Result()
+	if err != nil {
+		return false, false, err
+	}
+
+	// a "revoke all sessions" wins over whatever was cached for the token
+	if cutoff, ok := values[0].(string); ok {
+		revokedAt, err := strconv.ParseInt(cutoff, 10, 64)
+		if err != nil {
+			return false, false, err
+		}
+
+		if store.RevokedBefore(issuedAt, time.Unix(revokedAt, 0)) {
+			return true, true, nil
+		}
+	}
+
+	if state, ok := values[1].(string); ok {
+		return state == "1", true, nil
+	}
+
+	return false, false, nil
+}
+
+func (s *RevocationStore) Set(ctx context.Context, jti string, revoked bool, ttl time.Duration) error {
+	state := "0"
+	if revoked {
+		state = "1"
+	}
+
+	return s.rdb.SetEX(ctx, tokenKey(jti), state, ttl).Err()
+}
+
+// SetUserCutoff caches a "revoke all sessions". The ttl only needs to cover
+// the lifetime of the tokens issued before revokedAt.
+func (s *RevocationStore) SetUserCutoff(ctx context.Context, userID int64, revokedAt time.Time, ttl time.Duration) error {
+	return s.rdb.SetEX(ctx, userCutoffKey(userID), revokedAt.Unix(), ttl).Err()
+}
+
+func tokenKey(jti string) string {
+	return fmt.Sprintf("token-%v", jti)
+}
+
+func userCutoffKey(userID int64) string {
+	return fmt.Sprintf("revoked-user-%v", userID)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/Martins-Iroka/social/internal/store"
 	"github.com/go-redis/redis/v8"
@@ -11,11 +12,27 @@ type Storage struct {
 	User interface {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
+		Delete(context.Context, int64) error
+	}
+	Revocations interface {
+		Get(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, bool, error)
+		Set(ctx context.Context, jti string, revoked bool, ttl time.Duration) error
+		SetUserCutoff(ctx context.Context, userID int64, revokedAt time.Time, ttl time.Duration) error
+	}
+	Timelines interface {
+		Get(ctx context.Context, userID, beforeID int64, limit int) (*TimelinePage, error)
+		Set(ctx context.Context, userID int64, postIDs []int64, complete bool, ttl time.Duration) error
+		Push(ctx context.Context, postID int64, userIDs []int64, maxLen int) error
+		Delete(ctx context.Context, userID int64) error
+		AddCelebrity(ctx context.Context, userID int64) error
+		Celebrities(ctx context.Context) ([]int64, error)
 	}
 }
 
 func NewRedisStore(rdb *redis.Client) Storage {
 	return Storage{
-		User: &UserStore{rdb},
+		User:        &UserStore{rdb},
+		Revocations: &RevocationStore{rdb},
+		Timelines:   &TimelineStore{rdb},
 	}
 }
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Timelines are sorted sets of post IDs scored by the ID itself: IDs are handed
+// out in creation order, so they rank a timeline the way created_at does.
+//
+// A timeline that holds the whole feed of its user also has the member "0"
+// (score 0). Trimming drops it along with the oldest posts, which tells the
+// reader that the database has more than the cache.
+const (
+	completeMember = "0"
+	celebritiesKey = "timeline-celebrities"
+	// pushBatchSize bounds the keys a single script call touches
+	pushBatchSize = 1000
+)
+
+// pushScript adds ARGV[1] to the timelines in KEYS that are cached already
+// and trims them to ARGV[2] posts. Missing timelines are left alone, they're
+// rebuilt from the database when they're read.
+var pushScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if redis.call("EXISTS", key) == 1 then
+		redis.call("ZADD", key, ARGV[1], ARGV[1])
+		redis.call("ZREMRANGEBYRANK", key, 0, -tonumber(ARGV[2]) - 1)
+	end
+end
+return 0
+`)
+
+// TimelinePage is a slice of a cached timeline, newest first.
+type TimelinePage struct {
+	PostIDs []int64
+	// Complete is false once older posts were trimmed off the timeline, so a
+	// short page doesn't mean the feed ended.
+	Complete bool
+}
+
+type TimelineStore struct {
+	rdb *redis.Client
+}
+
+// Get returns up to limit post IDs lower than beforeID (0 for the newest
+// ones). It returns nil when the timeline isn't cached.
+func (s *TimelineStore) Get(ctx context.Context, userID, beforeID int64, limit int) (*TimelinePage, error) {
+	key := timelineKey(userID)
+
+	maxScore := "+inf"
+	if beforeID > 0 {
+		maxScore = "(" + strconv.FormatInt(beforeID, 10)
+	}
+
+	pipe := s.rdb.TxPipeline()
+	exists := pipe.Exists(ctx, key)
+	members := pipe.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
+		Max:   maxScore,
+		Min:   "(0",
+		Count: int64(limit),
+	})
+	complete := pipe.ZScore(ctx, key, completeMember)
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if exists.Val() == 0 {
+		return nil, nil
+	}
+
+	page := &TimelinePage{
+		PostIDs:  make([]int64, 0, len(members.Val())),
+		Complete: complete.Err() == nil,
+	}
+
+	for _, member := range members.Val() {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		page.PostIDs = append(page.PostIDs, id)
+	}
+
+	return page, nil
+}
+
+// Set replaces the user's timeline. complete tells whether postIDs is the
+// user's whole feed.
+func (s *TimelineStore) Set(ctx context.Context, userID int64, postIDs []int64, complete bool, ttl time.Duration) error {
+	key := timelineKey(userID)
+
+	members := make([]*redis.Z, 0, len(postIDs)+1)
+	for _, id := range postIDs {
+		members = append(members, &redis.Z{Score: float64(id), Member: id})
+	}
+
+	if complete {
+		members = append(members, &redis.Z{Score: 0, Member: completeMember})
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(members) > 0 {
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, ttl)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Push fans a new post out to the cached timelines of userIDs.
+func (s *TimelineStore) Push(ctx context.Context, postID int64, userIDs []int64, maxLen int) error {
+	for start := 0; start < len(userIDs); start += pushBatchSize {
+		end := min(start+pushBatchSize, len(userIDs))
+
+		keys := make([]string, 0, end-start)
+		for _, userID := range userIDs[start:end] {
+			keys = append(keys, timelineKey(userID))
+		}
+
+		if err := pushScript.Run(ctx, s.rdb, keys, postID, maxLen).Err(); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) error {
+	return s.rdb.Del(ctx, timelineKey(userID)).Err()
+}
+
+// AddCelebrity records a user whose posts aren't fanned out.
+func (s *TimelineStore) AddCelebrity(ctx context.Context, userID int64) error {
+	return s.rdb.SAdd(ctx, celebritiesKey, userID).Err()
+}
+
+func (s *TimelineStore) Celebrities(ctx context.Context) ([]int64, error) {
+	members, err := s.rdb.SMembers(ctx, celebritiesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%v", userID)
+}
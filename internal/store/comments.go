@@ -3,25 +3,42 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
+// Comment is either a top level comment of a post or, when ParentID is set, a
+// reply to another comment of the same post.
 type Comment struct {
-	ID       int64  `json:"id"`
-	PostID   int64  `json:"post_id"`
-	UserID   int64  `json:"user_id"`
-	Content  string `json:"content"`
-	CreateAt string `json:"created_at"`
-	User     User   `json:"user"`
+	ID           int64     `json:"id"`
+	PostID       int64     `json:"post_id"`
+	ParentID     *int64    `json:"parent_id"`
+	UserID       int64     `json:"user_id"`
+	Content      string    `json:"content"`
+	CreateAt     string    `json:"created_at"`
+	UpdatedAt    string    `json:"updated_at"`
+	Version      int       `json:"version"`
+	RepliesCount int       `json:"replies_count"`
+	Replies      []Comment `json:"replies,omitempty"`
+	User         User      `json:"user"`
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
+// CreateComment returns ErrorBlocked when the author of the post, or of the
+// comment being replied to, blocked the commenter.
 func (s *CommentStore) CreateComment(ctx context.Context, comment *Comment) error {
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3) RETURNING id, created_at
+		INSERT INTO comments (post_id, parent_id, user_id, content)
+		SELECT $1, $2, $3, $4 WHERE NOT EXISTS (
+			SELECT 1 FROM user_blocks b WHERE b.blocked_id = $3 AND b.blocker_id IN (
+				SELECT user_id FROM posts WHERE id = $1
+				UNION
+				SELECT user_id FROM comments WHERE id = $2
+			)
+		)
+		RETURNING id, created_at, updated_at, version
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -31,34 +48,75 @@ func (s *CommentStore) CreateComment(ctx context.Context, comment *Comment) erro
 		ctx,
 		query,
 		comment.PostID,
+		comment.ParentID,
 		comment.UserID,
 		comment.Content,
 	).Scan(
 		&comment.ID,
 		&comment.CreateAt,
+		&comment.UpdatedAt,
+		&comment.Version,
 	)
 
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorBlocked
+		default:
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+type PaginatedCommentQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"cursor"`
+	Order  string  `json:"order" validate:"oneof=asc desc"`
+}
+
+// ListByPostID pages through the top level comments of a post by
+// (created_at, id). The returned cursor is empty on the last page.
+func (s *CommentStore) ListByPostID(ctx context.Context, postID int64, q *PaginatedCommentQuery) ([]Comment, string, error) {
+	return s.list(ctx, "comments.post_id = $1 AND comments.parent_id IS NULL", postID, q)
+}
+
+// ListReplies pages through the direct replies of a comment the same way
+// ListByPostID does.
+func (s *CommentStore) ListReplies(ctx context.Context, parentID int64, q *PaginatedCommentQuery) ([]Comment, string, error) {
+	return s.list(ctx, "comments.parent_id = $1", parentID, q)
+}
+
+// list is the keyset paginated listing shared by ListByPostID and ListReplies,
+// filter is one of their fixed conditions on $1.
+func (s *CommentStore) list(ctx context.Context, filter string, arg int64, q *PaginatedCommentQuery) ([]Comment, string, error) {
+	// only ever one of the two fixed variants, never user input
+	order, cmp := "DESC", "<"
+	if q.Order == "asc" {
+		order, cmp = "ASC", ">"
+	}
+
 	query := `
-		SELECT comments.id, comments.post_id, comments.user_id, comments.content, comments.created_at, 
+		SELECT comments.id, comments.post_id, comments.parent_id, comments.user_id, comments.content,
+		comments.created_at, comments.updated_at, comments.version,
+		(SELECT COUNT(*) FROM comments r WHERE r.parent_id = comments.id) AS replies_count,
 		users.username, users.id, users.email FROM comments JOIN users on users.id = comments.user_id
-		WHERE comments.post_id = $1 ORDER BY comments.created_at DESC
+		WHERE ` + filter + `
+		AND ($2::timestamptz IS NULL OR (comments.created_at, comments.id) ` + cmp + ` ($2, $3::bigint))
+		ORDER BY comments.created_at ` + order + `, comments.id ` + order + `
+		LIMIT $4
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	createdAt, id := keysetArgs(q.Cursor)
 
+	// one extra row tells if there's a next page
+	rows, err := s.db.QueryContext(ctx, query, arg, createdAt, id, q.Limit+1)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
@@ -69,18 +127,211 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 		err := rows.Scan(
 			&c.ID,
 			&c.PostID,
+			&c.ParentID,
 			&c.UserID,
 			&c.Content,
 			&c.CreateAt,
+			&c.UpdatedAt,
+			&c.Version,
+			&c.RepliesCount,
 			&c.User.Username,
 			&c.User.ID,
 			&c.User.Email,
 		)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		comments = append(comments, c)
 	}
 
-	return comments, nil
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(comments) <= q.Limit {
+		return comments, "", nil
+	}
+
+	comments = comments[:q.Limit]
+	last := comments[len(comments)-1]
+
+	next, err := cursorFrom(last.CreateAt, last.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return comments, next, nil
+}
+
+type CommentThreadQuery struct {
+	Depth int `json:"depth" validate:"gte=0,lte=5"`
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+}
+
+// GetThread returns the comment with its replies nested up to q.Depth levels
+// below it, oldest first. Every comment carries at most q.Limit replies, the
+// rest are paged through ListReplies using RepliesCount to know they exist.
+func (s *CommentStore) GetThread(ctx context.Context, commentID int64, q *CommentThreadQuery) (*Comment, error) {
+	query := `
+		WITH RECURSIVE thread AS (
+			SELECT c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, c.updated_at, c.version,
+			0 AS level FROM comments c WHERE c.id = $1
+			UNION ALL
+			SELECT child.id, child.post_id, child.parent_id, child.user_id, child.content, child.created_at,
+			child.updated_at, child.version, thread.level + 1 FROM thread
+			JOIN LATERAL (
+				SELECT * FROM comments WHERE comments.parent_id = thread.id
+				ORDER BY comments.created_at, comments.id LIMIT $3
+			) child ON TRUE
+			WHERE thread.level < $2
+		)
+		SELECT thread.id, thread.post_id, thread.parent_id, thread.user_id, thread.content, thread.created_at,
+		thread.updated_at, thread.version,
+		(SELECT COUNT(*) FROM comments r WHERE r.parent_id = thread.id) AS replies_count,
+		users.username, users.id, users.email
+		FROM thread JOIN users ON users.id = thread.user_id
+		ORDER BY thread.level, thread.created_at, thread.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, commentID, q.Depth, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var root *Comment
+	children := make(map[int64][]*Comment)
+	for rows.Next() {
+		c := &Comment{}
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.ParentID,
+			&c.UserID,
+			&c.Content,
+			&c.CreateAt,
+			&c.UpdatedAt,
+			&c.Version,
+			&c.RepliesCount,
+			&c.User.Username,
+			&c.User.ID,
+			&c.User.Email,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// rows come level by level, so the first one is the root
+		if root == nil {
+			root = c
+			continue
+		}
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if root == nil {
+		return nil, ErrorNotFound
+	}
+
+	nestReplies(root, children)
+
+	return root, nil
+}
+
+func nestReplies(c *Comment, children map[int64][]*Comment) {
+	for _, child := range children[c.ID] {
+		nestReplies(child, children)
+		c.Replies = append(c.Replies, *child)
+	}
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
+	query := `
+		SELECT id, post_id, parent_id, user_id, content, created_at, updated_at, version FROM comments WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var comment Comment
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.ParentID,
+		&comment.UserID,
+		&comment.Content,
+		&comment.CreateAt,
+		&comment.UpdatedAt,
+		&comment.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &comment, nil
+}
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments SET content = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3 RETURNING updated_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		comment.Content,
+		comment.ID,
+		comment.Version,
+	).Scan(&comment.UpdatedAt, &comment.Version)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	query := `DELETE FROM comments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
 }
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrorInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a keyset pagination position: the (created_at, id) of the last
+// item of a page. Clients only ever see it encoded, as an opaque string.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+}
+
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrorInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID <= 0 || c.CreatedAt.IsZero() {
+		return nil, ErrorInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// OffsetCursor is the position of a page of a ranked listing, which has no
+// keyset to resume from: the offset of the page into the ranking.
+type OffsetCursor struct {
+	Offset int `json:"o"`
+}
+
+func (c OffsetCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeOffsetCursor(s string) (*OffsetCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrorInvalidCursor
+	}
+
+	var c OffsetCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Offset <= 0 {
+		return nil, ErrorInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// cursorFrom builds the cursor of an item whose created_at was scanned into a string.
+func cursorFrom(createdAt string, id int64) (string, error) {
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return "", err
+	}
+
+	return Cursor{CreatedAt: t, ID: id}.Encode(), nil
+}
+
+// keysetArgs are the query arguments of an optional cursor, NULL when there's none.
+func keysetArgs(c *Cursor) (any, any) {
+	if c == nil {
+		return nil, nil
+	}
+
+	return c.CreatedAt, c.ID
+}
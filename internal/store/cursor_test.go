@@ -0,0 +1,105 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+
+	t.Run("should decode an encoded cursor", func(t *testing.T) {
+		c, err := DecodeCursor(Cursor{CreatedAt: createdAt, ID: 7}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.ID != 7 || !c.CreatedAt.Equal(createdAt) {
+			t.Errorf("expected cursor (%v, 7); got (%v, %d)", createdAt, c.CreatedAt, c.ID)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"should reject invalid base64", "not base64!"},
+		{"should reject invalid json", base64.RawURLEncoding.EncodeToString([]byte("{"))},
+		{"should reject a missing id", Cursor{CreatedAt: createdAt}.Encode()},
+		{"should reject a negative id", Cursor{CreatedAt: createdAt, ID: -1}.Encode()},
+		{"should reject a missing time", Cursor{ID: 7}.Encode()},
+		{"should reject an empty cursor", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeCursor(tt.cursor); !errors.Is(err, ErrorInvalidCursor) {
+				t.Errorf("expected %v; got %v", ErrorInvalidCursor, err)
+			}
+		})
+	}
+}
+
+func TestCursorFrom(t *testing.T) {
+	t.Run("should encode the scanned created_at", func(t *testing.T) {
+		encoded, err := cursorFrom("2024-05-01T12:30:00.123456Z", 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := DecodeCursor(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+		if c.ID != 7 || !c.CreatedAt.Equal(want) {
+			t.Errorf("expected cursor (%v, 7); got (%v, %d)", want, c.CreatedAt, c.ID)
+		}
+	})
+
+	t.Run("should reject a malformed created_at", func(t *testing.T) {
+		if _, err := cursorFrom("2024-05-01 12:30:00", 7); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestDecodeOffsetCursor(t *testing.T) {
+	t.Run("should decode an encoded offset cursor", func(t *testing.T) {
+		c, err := DecodeOffsetCursor(OffsetCursor{Offset: 20}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Offset != 20 {
+			t.Errorf("expected offset 20; got %d", c.Offset)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"should reject invalid base64", "not base64!"},
+		{"should reject a zero offset", OffsetCursor{}.Encode()},
+		{"should reject a negative offset", OffsetCursor{Offset: -20}.Encode()},
+		{"should reject a keyset cursor", Cursor{CreatedAt: time.Now(), ID: 7}.Encode()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeOffsetCursor(tt.cursor); !errors.Is(err, ErrorInvalidCursor) {
+				t.Errorf("expected %v; got %v", ErrorInvalidCursor, err)
+			}
+		})
+	}
+
+	t.Run("should not decode an offset cursor as a keyset cursor", func(t *testing.T) {
+		if _, err := DecodeCursor(OffsetCursor{Offset: 20}.Encode()); !errors.Is(err, ErrorInvalidCursor) {
+			t.Errorf("expected %v; got %v", ErrorInvalidCursor, err)
+		}
+	})
+}
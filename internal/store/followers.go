@@ -0,0 +1,358 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Connection is a user in a followers or following list, with how they relate
+// to the user looking at the list.
+type Connection struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	FollowedAt  string `json:"followed_at"`
+	IsFollowing bool   `json:"is_following"`
+	FollowsYou  bool   `json:"follows_you"`
+}
+
+// Suggestion is a user the caller may want to follow. Mutuals is how many of
+// the users the caller follows follow them.
+type Suggestion struct {
+	ID         int64  `json:"id"`
+	Username   string `json:"username"`
+	Mutuals    int    `json:"mutuals"`
+	FollowsYou bool   `json:"follows_you"`
+}
+
+// FollowStats are the follow counts of a user and how they relate to the
+// user looking at them.
+type FollowStats struct {
+	FollowersCount int  `json:"followers_count"`
+	FollowingCount int  `json:"following_count"`
+	IsFollowing    bool `json:"is_following"`
+	FollowsYou     bool `json:"follows_you"`
+}
+
+type PaginatedFollowQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"cursor"`
+}
+
+// ListFollowers pages through the followers of userID newest first, as seen by viewerID.
+func (s *UserStore) ListFollowers(ctx context.Context, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	return s.listConnections(ctx, "f.user_id", "f.follower_id", userID, viewerID, q)
+}
+
+// ListFollowing pages through the users userID follows newest first, as seen by viewerID.
+func (s *UserStore) ListFollowing(ctx context.Context, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	return s.listConnections(ctx, "f.follower_id", "f.user_id", userID, viewerID, q)
+}
+
+// listConnections lists the users in the other column of the followers rows
+// where column is userID. Both are fixed column names, never user input.
+func (s *UserStore) listConnections(ctx context.Context, column, other string, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	query := `
+		SELECT u.id, u.username, f.created_at,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = u.id AND v.follower_id = $2) AS is_following,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = $2 AND v.follower_id = u.id) AS follows_you
+		FROM followers f JOIN users u ON u.id = ` + other + `
+		WHERE ` + column + ` = $1
+		AND ($3::timestamptz IS NULL OR (f.created_at, ` + other + `) < ($3, $4::bigint))
+		ORDER BY f.created_at DESC, ` + other + ` DESC
+		LIMIT $5
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	createdAt, id := keysetArgs(q.Cursor)
+
+	// one extra row tells if there's a next page
+	rows, err := s.db.QueryContext(ctx, query, userID, viewerID, createdAt, id, q.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	connections := []Connection{}
+	for rows.Next() {
+		var c Connection
+		err := rows.Scan(
+			&c.ID,
+			&c.Username,
+			&c.FollowedAt,
+			&c.IsFollowing,
+			&c.FollowsYou,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		connections = append(connections, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(connections) <= q.Limit {
+		return connections, "", nil
+	}
+
+	connections = connections[:q.Limit]
+	last := connections[len(connections)-1]
+
+	next, err := cursorFrom(last.FollowedAt, last.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return connections, next, nil
+}
+
+func (s *UserStore) GetFollowStats(ctx context.Context, userID, viewerID int64) (*FollowStats, error) {
+	query := `
+		SELECT
+		(SELECT COUNT(*) FROM followers WHERE user_id = $1) AS followers_count,
+		(SELECT COUNT(*) FROM followers WHERE follower_id = $1) AS following_count,
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2) AS is_following,
+		EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1) AS follows_you
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var stats FollowStats
+	err := s.db.QueryRowContext(ctx, query, userID, viewerID).Scan(
+		&stats.FollowersCount,
+		&stats.FollowingCount,
+		&stats.IsFollowing,
+		&stats.FollowsYou,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// ListFollowRequests pages through the pending requests to follow userID, newest first.
+func (s *UserStore) ListFollowRequests(ctx context.Context, userID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	query := `
+		SELECT u.id, u.username, fr.created_at,
+		EXISTS (SELECT 1 FROM followers v WHERE v.user_id = u.id AND v.follower_id = $1) AS is_following
+		FROM follow_requests fr JOIN users u ON u.id = fr.follower_id
+		WHERE fr.user_id = $1
+		AND ($2::timestamptz IS NULL OR (fr.created_at, fr.follower_id) < ($2, $3::bigint))
+		ORDER BY fr.created_at DESC, fr.follower_id DESC
+		LIMIT $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	createdAt, id := keysetArgs(q.Cursor)
+
+	// one extra row tells if there's a next page
+	rows, err := s.db.QueryContext(ctx, query, userID, createdAt, id, q.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	requests := []Connection{}
+	for rows.Next() {
+		var c Connection
+		if err := rows.Scan(&c.ID, &c.Username, &c.FollowedAt, &c.IsFollowing); err != nil {
+			return nil, "", err
+		}
+		requests = append(requests, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(requests) <= q.Limit {
+		return requests, "", nil
+	}
+
+	requests = requests[:q.Limit]
+	last := requests[len(requests)-1]
+
+	next, err := cursorFrom(last.FollowedAt, last.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return requests, next, nil
+}
+
+// ApproveFollowRequest turns the request of followerID into a follow of userID.
+func (s *UserStore) ApproveFollowRequest(ctx context.Context, userID, followerID int64) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteFollowRequest(ctx, tx, userID, followerID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)
+			ON CONFLICT (user_id, follower_id) DO NOTHING
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, userID, followerID)
+		return err
+	})
+}
+
+func (s *UserStore) DenyFollowRequest(ctx context.Context, userID, followerID int64) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		return s.deleteFollowRequest(ctx, tx, userID, followerID)
+	})
+}
+
+// SetPrivate changes the visibility of the user's account. Going public
+// approves every pending follow request, the new followers are returned.
+func (s *UserStore) SetPrivate(ctx context.Context, userID int64, private bool) ([]int64, error) {
+	approved := []int64{}
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `UPDATE users SET is_private = $1 WHERE id = $2`
+		if _, err := tx.ExecContext(ctx, query, private, userID); err != nil {
+			return err
+		}
+
+		if private {
+			return nil
+		}
+
+		query = `
+			WITH approved AS (
+				DELETE FROM follow_requests WHERE user_id = $1 RETURNING user_id, follower_id
+			)
+			INSERT INTO followers (user_id, follower_id) SELECT user_id, follower_id FROM approved
+			ON CONFLICT (user_id, follower_id) DO NOTHING
+			RETURNING follower_id
+		`
+
+		rows, err := tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			approved = append(approved, id)
+		}
+
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return approved, nil
+}
+
+// CanViewPosts reports whether viewerID can read the posts of authorID: they
+// weren't blocked and the account is public or they're an approved follower.
+func (s *UserStore) CanViewPosts(ctx context.Context, authorID, viewerID int64) (bool, error) {
+	query := `
+		SELECT NOT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)
+		AND (
+			$1 = $2
+			OR NOT EXISTS (SELECT 1 FROM users WHERE id = $1 AND is_private)
+			OR EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	if err := s.db.QueryRowContext(ctx, query, authorID, viewerID).Scan(&visible); err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
+
+func (s *UserStore) deleteFollowRequest(ctx context.Context, tx *sql.Tx, userID, followerID int64) error {
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND follower_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, userID, followerID)
+	if err != nil {
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// GetFollowSuggestions ranks the friends of friends of userID: the users
+// followed by the users they follow. Those following userID come first, then
+// the ones with the most mutuals. Users already followed or requested, and
+// blocks in either direction, are left out.
+func (s *UserStore) GetFollowSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	query := `
+		SELECT u.id, u.username, COUNT(*) AS mutuals,
+		EXISTS (SELECT 1 FROM followers y WHERE y.user_id = $1 AND y.follower_id = u.id) AS follows_you
+		FROM followers mine
+		JOIN followers theirs ON theirs.follower_id = mine.user_id
+		JOIN users u ON u.id = theirs.user_id
+		WHERE mine.follower_id = $1 AND u.id <> $1 AND u.is_active = true
+		AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.user_id = u.id AND fr.follower_id = $1)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+		)
+		GROUP BY u.id, u.username
+		ORDER BY follows_you DESC, mutuals DESC, u.id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var sg Suggestion
+		if err := rows.Scan(&sg.ID, &sg.Username, &sg.Mutuals, &sg.FollowsYou); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, sg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,324 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ExternalIdentity is a user as an OpenID Connect provider knows them.
+type ExternalIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+// OIDCLoginState is what the callback of a login needs from its start. Like
+// the other one-time tokens, only the hash of the state is stored.
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s *IdentityStore) CreateLoginState(ctx context.Context, state string, ls *OIDCLoginState) error {
+	query := `
+		INSERT INTO oidc_login_states (state, provider, nonce, code_verifier, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken(state), ls.Provider, ls.Nonce, ls.CodeVerifier, ls.Expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeLoginState returns the state once, ErrorNotFound if it expired.
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, state string) (*OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states WHERE state = $1
+		RETURNING provider, nonce, code_verifier, expiry
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var ls OIDCLoginState
+	err := s.db.QueryRowContext(ctx, query, hashToken(state)).Scan(
+		&ls.Provider,
+		&ls.Nonce,
+		&ls.CodeVerifier,
+		&ls.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if time.Now().After(ls.Expiry) {
+		return nil, ErrorNotFound
+	}
+
+	return &ls, nil
+}
+
+func (s *IdentityStore) DeleteExpiredLoginStates(ctx context.Context) (int64, error) {
+	query := `DELETE FROM oidc_login_states WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// Login finds the user the identity is linked to. An identity seen for the
+// first time is linked to the active user with the same email, or to a new
+// active user, as long as the provider verified the email. It returns
+// ErrorDuplicateEmail when the email belongs to a user it can't be linked to,
+// ErrorMissingEmail when a user has to be created without a verified email,
+// and ErrorNotFound when the linked user was deactivated.
+func (s *IdentityStore) Login(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	user, err := s.login(ctx, identity)
+	if !errors.Is(err, errLoginConflict) {
+		return user, err
+	}
+
+	// a concurrent first login linked the identity, or took the username,
+	// first: the retry sees what it committed
+	user, err = s.login(ctx, identity)
+	if errors.Is(err, errLoginConflict) {
+		return nil, ErrorConflict
+	}
+
+	return user, err
+}
+
+// errLoginConflict is a unique violation of a first login, only seen by Login.
+var errLoginConflict = errors.New("conflicting first login")
+
+func (s *IdentityStore) login(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	var user *User
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		linked, err := s.getLinkedUser(ctx, tx, identity)
+		switch {
+		case err == nil:
+			if !linked.IsActive {
+				return ErrorNotFound
+			}
+			user = linked
+			return nil
+		case err != ErrorNotFound:
+			return err
+		}
+
+		user, err = s.getUserByVerifiedEmail(ctx, tx, identity)
+		if err != nil && err != ErrorNotFound {
+			return err
+		}
+
+		if user == nil {
+			if user, err = s.createUser(ctx, tx, identity); err != nil {
+				return err
+			}
+		}
+
+		return s.link(ctx, tx, identity, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *IdentityStore) getLinkedUser(ctx context.Context, tx *sql.Tx, identity *ExternalIdentity) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.is_active, u.totp_enabled FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	err := tx.QueryRowContext(ctx, query, identity.Provider, identity.Subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.IsActive,
+		&user.MFAEnabled,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+func (s *IdentityStore) getUserByVerifiedEmail(ctx context.Context, tx *sql.Tx, identity *ExternalIdentity) (*User, error) {
+	if identity.Email == "" {
+		return nil, ErrorNotFound
+	}
+
+	query := `SELECT id, username, email, is_active, totp_enabled FROM users WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+	err := tx.QueryRowContext(ctx, query, identity.Email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.IsActive,
+		&user.MFAEnabled,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// taking over an account needs the provider to vouch for the email, and
+	// the account to be activated by its owner
+	if !identity.EmailVerified || !user.IsActive {
+		return nil, ErrorDuplicateEmail
+	}
+
+	return &user, nil
+}
+
+func (s *IdentityStore) createUser(ctx context.Context, tx *sql.Tx, identity *ExternalIdentity) (*User, error) {
+	// the account is active right away, so nobody confirms an email the
+	// provider didn't
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrorMissingEmail
+	}
+
+	username, err := s.availableUsername(ctx, tx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Username: username,
+		Email:    identity.Email,
+		Role: Role{
+			Name: "user",
+		},
+	}
+
+	// the user logs in through the provider, a password can be set with a reset
+	if err := user.Password.Set(uuid.New().String()); err != nil {
+		return nil, err
+	}
+
+	users := &UserStore{db: s.db}
+	if err := users.CreateUser(ctx, tx, user); err != nil {
+		switch err {
+		case ErrorDuplicateEmail, ErrorDuplicateUsername:
+			return nil, errLoginConflict
+		default:
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET is_active = true WHERE id = $1`, user.ID); err != nil {
+		return nil, err
+	}
+	user.IsActive = true
+
+	return user, nil
+}
+
+// availableUsername starts from the provider's preferred username, or the
+// local part of the email, and adds a suffix until nobody has it.
+func (s *IdentityStore) availableUsername(ctx context.Context, tx *sql.Tx, identity *ExternalIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if base == "" {
+		base = identity.Provider
+	}
+	if len(base) > 200 {
+		base = base[:200]
+	}
+
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	username := base
+	for range 5 {
+		var taken bool
+		if err := tx.QueryRowContext(ctx, query, username).Scan(&taken); err != nil {
+			return "", err
+		}
+
+		if !taken {
+			return username, nil
+		}
+
+		username = base + "_" + uuid.New().String()[:8]
+	}
+
+	return "", ErrorDuplicateUsername
+}
+
+func (s *IdentityStore) link(ctx context.Context, tx *sql.Tx, identity *ExternalIdentity, userID int64) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, identity.Provider, identity.Subject, userID, identity.Email)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return errLoginConflict
+	}
+
+	return err
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/Martins-Iroka/social/internal/totp"
+)
+
+// TOTP is the authenticator app of a user. The secret is kept from the
+// enrollment on, but it only counts once the user confirmed it with a code.
+// LastCounter is the last time step a code was accepted for, so a code can't
+// be replayed.
+type TOTP struct {
+	Secret      string
+	Enabled     bool
+	LastCounter int64
+}
+
+// MFAStore seals the TOTP secrets with secrets before they're written, so
+// they're never stored in the clear. Without secrets every TOTP operation
+// fails with ErrorTOTPUnavailable.
+type MFAStore struct {
+	db      *sql.DB
+	secrets *totp.SecretBox
+}
+
+// GetTOTP returns ErrorNotFound for users who never enrolled.
+func (s *MFAStore) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	query := `
+		SELECT totp_secret, totp_enabled, COALESCE(totp_last_counter, 0) FROM users
+		WHERE id = $1 AND totp_secret IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var t TOTP
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(
+		&t.Secret,
+		&t.Enabled,
+		&t.LastCounter,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if s.secrets == nil {
+		return nil, ErrorTOTPUnavailable
+	}
+
+	secret, err := s.secrets.Open(userID, t.Secret)
+	if err != nil {
+		return nil, err
+	}
+	t.Secret = secret
+
+	return &t, nil
+}
+
+// SetPendingTOTP starts an enrollment, replacing any unconfirmed one. It
+// returns ErrorConflict if TOTP is already enabled.
+func (s *MFAStore) SetPendingTOTP(ctx context.Context, userID int64, secret string) error {
+	if s.secrets == nil {
+		return ErrorTOTPUnavailable
+	}
+
+	sealed, err := s.secrets.Seal(userID, secret)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET totp_secret = $1, totp_last_counter = NULL WHERE id = $2 AND NOT totp_enabled`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, sealed, userID)
+	if err != nil {
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorConflict
+	}
+
+	return nil
+}
+
+// EnableTOTP confirms the enrollment with the time step of the code the user
+// entered and stores the hashes of their first recovery codes.
+func (s *MFAStore) EnableTOTP(ctx context.Context, userID, counter int64, codes []string) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET totp_enabled = true, totp_last_counter = $1
+			WHERE id = $2 AND totp_secret IS NOT NULL AND NOT totp_enabled
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, counter, userID)
+		if err != nil {
+			return err
+		}
+
+		row, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if row == 0 {
+			return ErrorConflict
+		}
+
+		return s.replaceRecoveryCodes(ctx, tx, userID, codes)
+	})
+}
+
+// UseTOTPCounter records that a code of the time step was accepted. It
+// returns ErrorConflict if that step, or a later one, was already used.
+func (s *MFAStore) UseTOTPCounter(ctx context.Context, userID, counter int64) error {
+	query := `
+		UPDATE users SET totp_last_counter = $1
+		WHERE id = $2 AND totp_enabled AND (totp_last_counter IS NULL OR totp_last_counter < $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, counter, userID)
+	if err != nil {
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorConflict
+	}
+
+	return nil
+}
+
+// UseRecoveryCode burns the code, ErrorNotFound if it doesn't exist or was
+// already used.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates every recovery code of the user in favour
+// of codes.
+func (s *MFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		return s.replaceRecoveryCodes(ctx, tx, userID, codes)
+	})
+}
+
+// DisableTOTP forgets the secret and the recovery codes of the user.
+func (s *MFAStore) DisableTOTP(ctx context.Context, userID int64) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_counter = NULL
+			WHERE id = $1
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+func (s *MFAStore) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO mfa_recovery_codes (user_id, code) VALUES ($1, $2)`
+
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, query, userID, hashToken(code)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
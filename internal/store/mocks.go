@@ -8,7 +8,16 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		User: &MockUserStore{},
+		Post:          &MockPostStore{},
+		User:          &MockUserStore{},
+		Comment:       &MockCommentStore{},
+		Reactions:     &MockReactionStore{},
+		Blocks:        &MockBlockStore{},
+		Roles:         &MockRoleStore{},
+		RefreshTokens: &MockRefreshTokenStore{},
+		Revocations:   &MockRevocationStore{cutoffs: map[int64]time.Time{}},
+		Identities:    &MockIdentityStore{states: map[string]*OIDCLoginState{}},
+		MFA:           &MockMFAStore{},
 	}
 }
 
@@ -20,22 +29,121 @@ func (s *MockUserStore) CreateUser(ctx context.Context, tx *sql.Tx, user *User)
 	return nil
 }
 
-func (s *MockUserStore) CreateAndInviteUser(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+func (s *MockUserStore) CreateAndInviteUser(ctx context.Context, user *User, token string, invitationExp time.Duration, email *Email) error {
 	return nil
 }
 
+// MockAdminID is the user of MockUserStore whose role has every permission.
+const MockAdminID int64 = 1
+
 func (s *MockUserStore) GetUserByID(ctx context.Context, userID int64) (*User, error) {
-	return nil, nil
+	if userID == MockMissingID {
+		return nil, ErrorNotFound
+	}
+
+	if userID == MockAdminID {
+		return &User{ID: userID, Role: Role{Name: "admin", Permissions: []string{
+			"posts:update:any",
+			"posts:delete:any",
+			"comments:update:any",
+			"comments:moderate",
+			"users:sessions:revoke",
+			"roles:manage",
+		}}}, nil
+	}
+
+	return &User{ID: userID}, nil
 }
 
-func (s *MockUserStore) FollowUser(ctx context.Context, followerID int64, userID int64) error {
-	return nil
+// MockBlockedUserID blocked every other user of the mock stores, they can't
+// follow them or see their posts.
+const MockBlockedUserID int64 = 13
+
+// MockPrivateUserID has a private account, following them only sends a
+// request and their posts are hidden.
+const MockPrivateUserID int64 = 11
+
+func (s *MockUserStore) FollowUser(ctx context.Context, followerID int64, userID int64) (bool, error) {
+	if followerID == userID {
+		return false, ErrorSelfFollow
+	}
+
+	switch userID {
+	case MockMissingID:
+		return false, ErrorNotFound
+	case MockBlockedUserID:
+		return false, ErrorBlocked
+	case MockPrivateUserID:
+		return true, nil
+	}
+
+	return false, nil
 }
 
 func (s *MockUserStore) UnFollowUser(ctx context.Context, followerID int64, userID int64) error {
+	if userID == MockMissingID {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s *MockUserStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s *MockUserStore) FollowsAny(ctx context.Context, followerID int64, userIDs []int64) (bool, error) {
+	return false, nil
+}
+
+func (s *MockUserStore) ListFollowers(ctx context.Context, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	return []Connection{}, "", nil
+}
+
+func (s *MockUserStore) ListFollowing(ctx context.Context, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	return []Connection{}, "", nil
+}
+
+func (s *MockUserStore) GetFollowStats(ctx context.Context, userID, viewerID int64) (*FollowStats, error) {
+	return &FollowStats{}, nil
+}
+
+func (s *MockUserStore) ListFollowRequests(ctx context.Context, userID int64, q *PaginatedFollowQuery) ([]Connection, string, error) {
+	return []Connection{}, "", nil
+}
+
+func (s *MockUserStore) ApproveFollowRequest(ctx context.Context, userID, followerID int64) error {
+	if followerID == MockMissingID {
+		return ErrorNotFound
+	}
+
 	return nil
 }
 
+func (s *MockUserStore) DenyFollowRequest(ctx context.Context, userID, followerID int64) error {
+	if followerID == MockMissingID {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s *MockUserStore) SetPrivate(ctx context.Context, userID int64, private bool) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s *MockUserStore) CanViewPosts(ctx context.Context, authorID, viewerID int64) (bool, error) {
+	if authorID == MockBlockedUserID || authorID == MockPrivateUserID {
+		return viewerID == authorID, nil
+	}
+
+	return true, nil
+}
+
+func (s *MockUserStore) GetFollowSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	return []Suggestion{}, nil
+}
+
 func (s *MockUserStore) ActivateUser(ctx context.Context, token string) error {
 	return nil
 }
@@ -44,6 +152,381 @@ func (s *MockUserStore) DeleteUser(ctx context.Context, userID int64) error {
 	return nil
 }
 
+// MockUnknownEmail isn't registered in MockUserStore.
+const MockUnknownEmail = "unknown@example.com"
+
+// MockPassword is the password of the users MockUserStore finds by email.
+const MockPassword = "mock-password"
+
 func (s *MockUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	return nil, nil
+	if email == MockUnknownEmail {
+		return nil, ErrorNotFound
+	}
+
+	user := &User{ID: 42, Username: "user", Email: email, Locale: "en", IsActive: true}
+	if err := user.Password.Set(MockPassword); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *Email) error {
+	return nil
+}
+
+func (s *MockUserStore) GetPendingUserByEmail(ctx context.Context, email string) (*User, error) {
+	return &User{ID: 42, Username: "pending", Email: email}, nil
+}
+
+func (s *MockUserStore) RotateInvitation(ctx context.Context, userID int64, token string, invitationExp time.Duration, email *Email) error {
+	return nil
+}
+
+func (s *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *MockUserStore) DeleteInactiveUsers(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	return 0, nil
+}
+
+// MockExpiredResetToken is rejected by MockUserStore as expired.
+const MockExpiredResetToken = "expired-reset-token"
+
+func (s *MockUserStore) ResetPassword(ctx context.Context, token string, newPassword string) (*User, time.Time, error) {
+	if token == MockExpiredResetToken {
+		return nil, time.Time{}, ErrorNotFound
+	}
+
+	return &User{ID: 42}, time.Now(), nil
+}
+
+// MockReusedRefreshToken is rejected by MockRefreshTokenStore as already used.
+const MockReusedRefreshToken = "reused-refresh-token"
+
+type MockRefreshTokenStore struct {
+}
+
+func (s *MockRefreshTokenStore) Create(ctx context.Context, token string, rt *RefreshToken) error {
+	return nil
+}
+
+func (s *MockRefreshTokenStore) Rotate(ctx context.Context, token, newToken string, exp time.Duration) (*RefreshToken, error) {
+	if token == MockReusedRefreshToken {
+		return nil, ErrorRefreshTokenReused
+	}
+
+	return &RefreshToken{UserID: 42, Expiry: time.Now().Add(exp)}, nil
+}
+
+func (s *MockRefreshTokenStore) Revoke(ctx context.Context, token string, userID int64) error {
+	return nil
+}
+
+func (s *MockRefreshTokenStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// MockRevokedJTI is reported as revoked by MockRevocationStore.
+const MockRevokedJTI = "revoked-jti"
+
+type MockRevocationStore struct {
+	cutoffs map[int64]time.Time
+}
+
+func (s *MockRevocationStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	return nil
+}
+
+func (s *MockRevocationStore) RevokeAllForUser(ctx context.Context, userID int64) (time.Time, error) {
+	revokedAt := time.Now().Truncate(time.Second)
+	s.cutoffs[userID] = revokedAt
+
+	return revokedAt, nil
+}
+
+func (s *MockRevocationStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	if revokedAt, ok := s.cutoffs[userID]; ok && RevokedBefore(issuedAt, revokedAt) {
+		return true, nil
+	}
+
+	return jti == MockRevokedJTI, nil
+}
+
+func (s *MockRevocationStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// MockIdentityStore keeps the login states in memory and logs every identity
+// with a verified email in as user 1.
+type MockIdentityStore struct {
+	states map[string]*OIDCLoginState
+}
+
+func (s *MockIdentityStore) CreateLoginState(ctx context.Context, state string, ls *OIDCLoginState) error {
+	s.states[state] = ls
+	return nil
+}
+
+func (s *MockIdentityStore) ConsumeLoginState(ctx context.Context, state string) (*OIDCLoginState, error) {
+	ls, ok := s.states[state]
+	if !ok {
+		return nil, ErrorNotFound
+	}
+	delete(s.states, state)
+	return ls, nil
+}
+
+func (s *MockIdentityStore) DeleteExpiredLoginStates(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *MockIdentityStore) Login(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	if !identity.EmailVerified {
+		return nil, ErrorMissingEmail
+	}
+
+	return &User{ID: 1, Email: identity.Email, IsActive: true}, nil
+}
+
+// MockMFAStore has every user enrolled with MockTOTPSecret, but not enabled.
+type MockMFAStore struct {
+}
+
+// MockTOTPSecret is the TOTP secret of every user of MockMFAStore.
+const MockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func (s *MockMFAStore) GetTOTP(ctx context.Context, userID int64) (*TOTP, error) {
+	return &TOTP{Secret: MockTOTPSecret}, nil
+}
+
+func (s *MockMFAStore) SetPendingTOTP(ctx context.Context, userID int64, secret string) error {
+	return nil
+}
+
+func (s *MockMFAStore) EnableTOTP(ctx context.Context, userID, counter int64, codes []string) error {
+	return nil
+}
+
+func (s *MockMFAStore) UseTOTPCounter(ctx context.Context, userID, counter int64) error {
+	return nil
+}
+
+func (s *MockMFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	return ErrorNotFound
+}
+
+func (s *MockMFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error {
+	return nil
+}
+
+func (s *MockMFAStore) DisableTOTP(ctx context.Context, userID int64) error {
+	return nil
+}
+
+// MockMissingID isn't a user, a post or a comment of the mock stores.
+const MockMissingID int64 = 404
+
+// MockOthersID is a post, and a comment, that MockOtherUserID wrote. The posts
+// MockBlockedUserID and MockPrivateUserID are written by the users of the same
+// ID, every other post and comment belongs to user 42, the user of the test
+// tokens.
+const (
+	MockOthersID    int64 = 2
+	MockOtherUserID int64 = 7
+)
+
+func mockAuthorOf(id int64) int64 {
+	switch id {
+	case MockOthersID:
+		return MockOtherUserID
+	case MockBlockedUserID, MockPrivateUserID:
+		return id
+	}
+
+	return 42
+}
+
+type MockPostStore struct {
+}
+
+func (s *MockPostStore) Create(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (s *MockPostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
+	if postID == MockMissingID {
+		return nil, ErrorNotFound
+	}
+
+	return &Post{ID: postID, UserID: mockAuthorOf(postID)}, nil
+}
+
+func (s *MockPostStore) GetWithMetadata(ctx context.Context, postID, userID int64) (*PostWithMetadata, error) {
+	post, err := s.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostWithMetadata{Post: *post}, nil
+}
+
+func (s *MockPostStore) GetUserFeed(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error) {
+	return []PostWithMetadata{}, "", nil
+}
+
+func (s *MockPostStore) GetPosts(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error) {
+	return []PostWithMetadata{}, "", nil
+}
+
+func (s *MockPostStore) GetPostsByUser(ctx context.Context, authorID, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error) {
+	return []PostWithMetadata{}, "", nil
+}
+
+func (s *MockPostStore) GetUserFeedIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (s *MockPostStore) GetByIDs(ctx context.Context, postIDs []int64, userID int64) ([]PostWithMetadata, error) {
+	return []PostWithMetadata{}, nil
+}
+
+func (s *MockPostStore) Delete(ctx context.Context, postID int64) error {
+	return nil
+}
+
+func (s *MockPostStore) Update(ctx context.Context, post *Post) error {
+	return nil
+}
+
+// MockCommentStore has every comment on post 1.
+type MockCommentStore struct {
+}
+
+func (s *MockCommentStore) CreateComment(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (s *MockCommentStore) ListByPostID(ctx context.Context, postID int64, q *PaginatedCommentQuery) ([]Comment, string, error) {
+	return []Comment{}, "", nil
+}
+
+func (s *MockCommentStore) ListReplies(ctx context.Context, parentID int64, q *PaginatedCommentQuery) ([]Comment, string, error) {
+	return []Comment{}, "", nil
+}
+
+func (s *MockCommentStore) GetThread(ctx context.Context, commentID int64, q *CommentThreadQuery) (*Comment, error) {
+	return s.GetByID(ctx, commentID)
+}
+
+func (s *MockCommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error) {
+	if commentID == MockMissingID {
+		return nil, ErrorNotFound
+	}
+
+	return &Comment{ID: commentID, PostID: 1, UserID: mockAuthorOf(commentID)}, nil
+}
+
+func (s *MockCommentStore) Update(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (s *MockCommentStore) Delete(ctx context.Context, commentID int64) error {
+	return nil
+}
+
+type MockReactionStore struct {
+}
+
+func (s *MockReactionStore) React(ctx context.Context, postID, userID int64, kind string) error {
+	return nil
+}
+
+func (s *MockReactionStore) Unreact(ctx context.Context, postID, userID int64, kind string) error {
+	return nil
+}
+
+type MockBlockStore struct {
+}
+
+func (s *MockBlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (s *MockBlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	return nil
+}
+
+func (s *MockBlockStore) Mute(ctx context.Context, muterID, mutedID int64) error {
+	return nil
+}
+
+func (s *MockBlockStore) Unmute(ctx context.Context, muterID, mutedID int64) error {
+	return nil
+}
+
+// MockBuiltinRoleID is the seeded role of MockRoleStore, it can't be modified.
+// MockRoleStore has a custom role for every other ID but MockMissingID.
+const MockBuiltinRoleID int64 = 1
+
+type MockRoleStore struct {
+}
+
+func (s *MockRoleStore) GetByName(ctx context.Context, name string) (*Role, error) {
+	return &Role{ID: 2, Name: name, Permissions: []string{}}, nil
+}
+
+func (s *MockRoleStore) GetByID(ctx context.Context, roleID int64) (*Role, error) {
+	switch roleID {
+	case MockMissingID:
+		return nil, ErrorNotFound
+	case MockBuiltinRoleID:
+		return &Role{ID: roleID, Name: "admin", Permissions: []string{}}, nil
+	}
+
+	return &Role{ID: roleID, Name: "custom", Permissions: []string{}}, nil
+}
+
+func (s *MockRoleStore) GetAll(ctx context.Context) ([]Role, error) {
+	return []Role{}, nil
+}
+
+func (s *MockRoleStore) Create(ctx context.Context, role *Role) error {
+	if role.Name == "admin" {
+		return ErrorDuplicateRole
+	}
+
+	return nil
+}
+
+func (s *MockRoleStore) Update(ctx context.Context, role *Role) error {
+	return s.modify(role.ID)
+}
+
+func (s *MockRoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return s.modify(roleID)
+}
+
+func (s *MockRoleStore) modify(roleID int64) error {
+	switch roleID {
+	case MockMissingID:
+		return ErrorNotFound
+	case MockBuiltinRoleID:
+		return ErrorBuiltinRole
+	}
+
+	return nil
+}
+
+func (s *MockRoleStore) Assign(ctx context.Context, userID, roleID int64) error {
+	if userID == MockMissingID || roleID == MockMissingID {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+func (s *MockRoleStore) GetUserIDs(ctx context.Context, roleID int64) ([]int64, error) {
+	return []int64{MockOtherUserID}, nil
 }
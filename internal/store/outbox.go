@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSent    = "sent"
+	// EmailStatusDead is for the emails that ran out of attempts
+	EmailStatusDead = "dead"
+)
+
+// Email is a message waiting in the outbox to be rendered and sent by a worker.
+type Email struct {
+	ID       int64           `json:"id"`
+	Template string          `json:"template"`
+	Username string          `json:"username"`
+	Email    string          `json:"email"`
+	Locale   string          `json:"locale"`
+	Data     json.RawMessage `json:"data"`
+	Attempts int             `json:"attempts"`
+}
+
+// NewEmail is rendered from template, translated to locale when there's one for it.
+func NewEmail(template, username, email, locale string, data any) (*Email, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Email{
+		Template: template,
+		Username: username,
+		Email:    email,
+		Locale:   locale,
+		Data:     raw,
+	}, nil
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+// Claim locks up to limit emails that are due for this worker. Each claim
+// counts as an attempt, and the email is leased until lease passes so it
+// is picked up again if the worker dies before reporting back.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]Email, error) {
+	query := `
+		UPDATE email_outbox SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM email_outbox WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, template, username, email, locale, data, attempts
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := []Email{}
+	for rows.Next() {
+		var e Email
+		err := rows.Scan(
+			&e.ID,
+			&e.Template,
+			&e.Username,
+			&e.Email,
+			&e.Locale,
+			&e.Data,
+			&e.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+
+	return emails, rows.Err()
+}
+
+// MarkSent also redacts the template data, it carries the one-time tokens of
+// the links in the email.
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	query := `UPDATE email_outbox SET status = $1, sent_at = NOW(), last_error = NULL, data = '{}' WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, EmailStatusSent, id)
+	return err
+}
+
+// MarkFailed schedules another attempt at nextAttempt.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error {
+	query := `UPDATE email_outbox SET last_error = $1, next_attempt_at = $2 WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, lastError, nextAttempt, id)
+	return err
+}
+
+// MarkDead dead letters the email, it stays in the table for inspection but is
+// never retried. Like MarkSent, it redacts the template data.
+func (s *OutboxStore) MarkDead(ctx context.Context, id int64, lastError string) error {
+	query := `UPDATE email_outbox SET status = $1, last_error = $2, data = '{}' WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, EmailStatusDead, lastError, id)
+	return err
+}
+
+// enqueueEmail writes the email in the caller's transaction, so it's only
+// sent if whatever it's about is committed too.
+func enqueueEmail(ctx context.Context, tx *sql.Tx, email *Email) error {
+	query := `
+		INSERT INTO email_outbox (template, username, email, locale, data)
+		VALUES ($1, $2, $3, COALESCE(NULLIF($4, ''), 'en'), $5) RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		email.Template,
+		email.Username,
+		email.Email,
+		email.Locale,
+		string(email.Data),
+	).Scan(&email.ID)
+}
@@ -3,42 +3,67 @@ package store
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
-	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/Martins-Iroka/social/internal/ranking"
 	"github.com/lib/pq"
 )
 
-// CommentList implements sql.Scanner for JSONB array data
-type CommentList []Comment
-
 type Post struct {
-	ID        int64       `json:"id"` //Json unmarshal
-	Content   string      `json:"content"`
-	Title     string      `json:"title"`
-	UserID    int64       `json:"user_id"`
-	Tags      []string    `json:"tags"`
-	CreatedAt string      `json:"created_at"`
-	UpdatedAt string      `json:"updated_at"`
-	Version   string      `json:"version"`
-	Comments  CommentList `json:"comments"`
-	User      User        `json:"user"`
+	ID        int64     `json:"id"` //Json unmarshal
+	Content   string    `json:"content"`
+	Title     string    `json:"title"`
+	UserID    int64     `json:"user_id"`
+	Tags      []string  `json:"tags"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+	Version   string    `json:"version"`
+	Comments  []Comment `json:"comments,omitempty"`
+	User      User      `json:"user"`
 }
 
 type PostWithMetadata struct {
 	Post
-	CommentCount int `json:"comments_count"`
+	CommentCount int            `json:"comments_count"`
+	Reactions    ReactionCounts `json:"reactions"`
+	ReactedByMe  []string       `json:"reacted_by_me"`
 }
 
+// visibleToViewer keeps the posts of p that $1 can read: its author didn't
+// block them and the account is public or they're an approved follower.
+const visibleToViewer = `
+	NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = p.user_id AND b.blocked_id = $1)
+	AND (
+		p.user_id = $1
+		OR NOT EXISTS (SELECT 1 FROM users a WHERE a.id = p.user_id AND a.is_private)
+		OR EXISTS (SELECT 1 FROM followers v WHERE v.user_id = p.user_id AND v.follower_id = $1)
+	)
+`
+
+// postMetadataColumns are the PostWithMetadata columns of post p as seen by
+// the user in $1.
+const postMetadataColumns = `
+	(SELECT COUNT(c.id) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+	(SELECT COALESCE(JSONB_OBJECT_AGG(r.kind, r.n), '{}') FROM (
+		SELECT kind, COUNT(*) AS n FROM post_reactions WHERE post_id = p.id GROUP BY kind
+	) r) AS reactions,
+	ARRAY(SELECT kind FROM post_reactions WHERE post_id = p.id AND user_id = $1 ORDER BY kind) AS reacted_by_me
+`
+
+// PaginatedFeedQuery pages with Cursor when it's set and with Offset otherwise,
+// the offset mode is only kept for older clients and the ranked sorts.
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	Limit  int        `json:"limit" validate:"gte=1,lte=20"`
+	Offset int        `json:"offset" validate:"gte=0"`
+	Cursor *Cursor    `json:"cursor"`
+	Sort   string     `json:"sort" validate:"oneof=asc desc top hot trending"`
+	Tags   []string   `json:"tags" validate:"max=5"`
+	Search string     `json:"search" validate:"max=100"`
+	Since  *time.Time `json:"since"`
+	Until  *time.Time `json:"until"`
 }
 
 type PostStore struct {
@@ -106,74 +131,189 @@ func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
 	return &post, nil
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, error) {
-	// query := `
-	// 	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username,
-	// 	COUNT(c.id) AS comments_count FROM posts p LEFT JOIN comments c ON c.post_id = p.id
-	// 	LEFT JOIN users u ON p.user_id = u.id JOIN followers f ON f.follower_id = p.user_id OR
-	// 	p.user_id = $1 WHERE f.user_id = $1 OR p.user_id = $1 GROUP BY p.id, u.username
-	// 	ORDER BY p.created_at DESC
-	// OR (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
-	//OR (p.tags @> $5 OR $5 = '{}')
-	// `
+// GetWithMetadata is GetByID with the comment count and reactions of the
+// post, ReactedByMe being the reactions of userID. It returns ErrorNotFound
+// when userID can't read the post.
+func (s *PostStore) GetWithMetadata(ctx context.Context, postID, userID int64) (*PostWithMetadata, error) {
 	query := `
-        SELECT
-            p.id, p.user_id, p.title, p.content, p.created_at, p.version,
-            p.tags,
-            u.username,
-            COALESCE(
-                c_agg.comments_json,
-                '[]'::jsonb
-            ) AS comments, -- Aggregated comments array
-            (SELECT COUNT(c.id) FROM comments c WHERE c.post_id = p.id) AS comments_count -- Simpler way to get count
-        FROM
-            posts p
-        LEFT JOIN
-            users u ON p.user_id = u.id
-        -- Aggregation of comments into a JSON array for each post
-        LEFT JOIN LATERAL (
-            SELECT
-                JSONB_AGG(
-                    JSONB_BUILD_OBJECT(
-                        'id', c.id,
-                        'content', c.content,
-                        'created_at', c.created_at,
-                        'user', JSONB_BUILD_OBJECT(
-                            'id', cu.id,
-                            'username', cu.username
-                        )
-                    )
-                ) AS comments_json
-            FROM
-                comments c
-            LEFT JOIN
-                users cu ON c.user_id = cu.id
-            WHERE
-                c.post_id = p.id
-        ) c_agg ON TRUE
-        -- Feed Logic
-        JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-        WHERE f.user_id = $1 OR p.user_id = $1 -- come back and filter
-        GROUP BY p.id, u.username, c_agg.comments_json
-        ORDER BY p.created_at ` + feedQuery.Sort + `
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, p.tags, p.version,` + postMetadataColumns + `
+		FROM posts p WHERE p.id = $2 AND` + visibleToViewer + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var post PostWithMetadata
+	err := s.db.QueryRowContext(ctx, query, userID, postID).Scan(
+		&post.ID,
+		&post.UserID,
+		&post.Title,
+		&post.Content,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		pq.Array(&post.Tags),
+		&post.Version,
+		&post.CommentCount,
+		&post.Reactions,
+		pq.Array(&post.ReactedByMe),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &post, nil
+}
+
+// rankedCandidates bounds how many of the newest matching posts sort=top and
+// sort=hot rank, the pages are offsets into that ranking. The API descriptions
+// of the feed and post listings state it.
+const rankedCandidates = 500
+
+// rankingModes maps the ranked sorts to how they're scored, trending being the
+// older name of hot.
+var rankingModes = map[string]ranking.Mode{
+	"top":      ranking.Top,
+	"hot":      ranking.Hot,
+	"trending": ranking.Hot,
+}
+
+// latestPosts and rankedPosts select the posts of the listings, along with the
+// interactions of the viewer ($1) with each author: how many times they
+// commented on or reacted to the author's posts. Only the ranked sorts score
+// that affinity, the other listings leave it at 0.
+const (
+	latestPosts = `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version,
+			p.tags,
+			u.username,` + postMetadataColumns + `,
+			0 AS interactions
+		FROM posts p
+		LEFT JOIN users u ON p.user_id = u.id
+	`
+	rankedPosts = `
+		WITH interactions AS (
+			SELECT ip.user_id AS author_id, COUNT(*) AS n FROM (
+				SELECT post_id FROM comments WHERE user_id = $1
+				UNION ALL
+				SELECT post_id FROM post_reactions WHERE user_id = $1
+			) i JOIN posts ip ON ip.id = i.post_id
+			GROUP BY ip.user_id
+		)
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version,
+			p.tags,
+			u.username,` + postMetadataColumns + `,
+			COALESCE(i.n, 0) AS interactions
+		FROM posts p
+		LEFT JOIN users u ON p.user_id = u.id
+		LEFT JOIN interactions i ON i.author_id = p.user_id
+	`
+)
+
+// IsRankedSort tells if sort is one of the ranked sorts, which page with an
+// OffsetCursor instead of a Cursor.
+func IsRankedSort(sort string) bool {
+	_, ranked := rankingModes[sort]
+	return ranked
+}
+
+// GetUserFeed returns a page of the user's feed: their own posts and the posts
+// of the users they follow and didn't mute. The cursor of the next page is
+// empty on the last one, it's an OffsetCursor with the ranked sorts.
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error) {
+	scope := `(p.user_id = $1 OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $1))
+		AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)`
+	return s.list(ctx, userID, feedQuery, scope)
+}
+
+// GetPosts is GetUserFeed over every post, userID only being the viewer.
+func (s *PostStore) GetPosts(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error) {
+	return s.list(ctx, userID, feedQuery, "TRUE")
+}
+
+// GetPostsByUser is GetUserFeed over the posts of authorID as seen by userID.
+func (s *PostStore) GetPostsByUser(ctx context.Context, authorID, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error) {
+	return s.list(ctx, userID, feedQuery, "p.user_id = $10", authorID)
+}
+
+// list is the post listing behind the feeds, it only shows the posts the
+// viewer can read. scope is one of their fixed conditions, it
+// can use $1 (the viewer) and $10 onwards for scopeArgs.
+func (s *PostStore) list(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery, scope string, scopeArgs ...any) ([]PostWithMetadata, string, error) {
+	mode, ranked := rankingModes[feedQuery.Sort]
+
+	// only ever one of the fixed variants, never user input
+	cmp, order := "<", "DESC"
+	if feedQuery.Sort == "asc" {
+		cmp, order = ">", "ASC"
+	}
+
+	// one extra row tells if there's a next page
+	limit, offset := feedQuery.Limit+1, feedQuery.Offset
+	since := feedQuery.Since
+	if ranked {
+		limit, offset = rankedCandidates, 0
+		if since == nil {
+			t := time.Now().Add(-mode.Window())
+			since = &t
+		}
+	}
+
+	selectPosts := latestPosts
+	if ranked {
+		selectPosts = rankedPosts
+	}
+
+	// Comments aren't embedded, they're paged through GET /posts/{postID}/comments
+	query := selectPosts + `
+		WHERE ` + scope + `
+		AND` + visibleToViewer + `
+		AND ($4 = '' OR p.title ILIKE '%' || $4 || '%' ESCAPE '\' OR p.content ILIKE '%' || $4 || '%' ESCAPE '\')
+		AND (COALESCE(CARDINALITY($5::varchar(100)[]), 0) = 0 OR p.tags @> $5::varchar(100)[])
+		AND ($6::timestamptz IS NULL OR p.created_at >= $6)
+		AND ($7::timestamptz IS NULL OR p.created_at <= $7)
+		AND ($8::timestamptz IS NULL OR (p.created_at, p.id) ` + cmp + ` ($8, $9::bigint))
+		ORDER BY p.created_at ` + order + `, p.id ` + order + `
 		LIMIT $2 OFFSET $3
-    `
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(
-		ctx, query, userID, feedQuery.Limit, feedQuery.Offset)
+	createdAt, id := keysetArgs(feedQuery.Cursor)
+
+	args := []any{
+		userID,
+		limit,
+		offset,
+		escapeLike(feedQuery.Search),
+		pq.Array(feedQuery.Tags),
+		since,
+		feedQuery.Until,
+		createdAt,
+		id,
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, append(args, scopeArgs...)...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	feed := []PostWithMetadata{}
+	interactions := []int{}
 
 	for rows.Next() {
 		var p PostWithMetadata
+		var n int
 		err := rows.Scan(
 			&p.ID,
 			&p.UserID,
@@ -183,16 +323,177 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, feedQuery *Pa
 			&p.Version,
 			pq.Array(&p.Tags),
 			&p.User.Username,
-			&p.Comments,
 			&p.CommentCount,
+			&p.Reactions,
+			pq.Array(&p.ReactedByMe),
+			&n,
 		)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		feed = append(feed, p)
+		interactions = append(interactions, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if ranked {
+		feed, more, err := rank(mode, feed, interactions, feedQuery.Offset, feedQuery.Limit)
+		if err != nil || !more {
+			return feed, "", err
+		}
+
+		return feed, OffsetCursor{Offset: feedQuery.Offset + feedQuery.Limit}.Encode(), nil
+	}
+
+	if len(feed) <= feedQuery.Limit {
+		return feed, "", nil
+	}
+
+	feed = feed[:feedQuery.Limit]
+	last := feed[len(feed)-1]
+
+	next, err := cursorFrom(last.CreatedAt, last.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return feed, next, nil
+}
+
+// rank orders the candidates by their ranking score and returns the
+// [offset, offset+limit) page of them, more tells if candidates are left after it.
+func rank(mode ranking.Mode, candidates []PostWithMetadata, interactions []int, offset, limit int) ([]PostWithMetadata, bool, error) {
+	type scored struct {
+		post  PostWithMetadata
+		score float64
+	}
+
+	now := time.Now()
+	posts := make([]scored, 0, len(candidates))
+	for i, p := range candidates {
+		createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+		if err != nil {
+			return nil, false, err
+		}
+
+		reactions := 0
+		for _, n := range p.Reactions {
+			reactions += n
+		}
+
+		score := ranking.Score(mode, ranking.Signals{
+			Comments:     p.CommentCount,
+			Reactions:    reactions,
+			Interactions: interactions[i],
+			CreatedAt:    createdAt,
+		}, ranking.DefaultWeights, now)
+
+		posts = append(posts, scored{post: p, score: score})
+	}
+
+	// candidates come newest first, a stable sort keeps ties that way
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].score > posts[j].score
+	})
+
+	page := []PostWithMetadata{}
+	for i := offset; i < len(posts) && i < offset+limit; i++ {
+		page = append(page, posts[i].post)
+	}
+
+	return page, offset+limit < len(posts), nil
+}
+
+// GetUserFeedIDs returns the IDs of the newest limit posts of the user's feed,
+// newest first. It's how a cached timeline gets rebuilt.
+func (s *PostStore) GetUserFeedIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	query := `
+		SELECT p.id FROM posts p
+		WHERE (p.user_id = $1 OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $1))
+		AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+		AND` + visibleToViewer + `
+		ORDER BY p.id DESC
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
 	}
-	return feed, nil
+
+	return ids, rows.Err()
+}
+
+// GetByIDs loads the posts in postIDs in the same order as seen by userID.
+// Posts that don't exist anymore, or that userID can't read, are left out.
+func (s *PostStore) GetByIDs(ctx context.Context, postIDs []int64, userID int64) ([]PostWithMetadata, error) {
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username,` + postMetadataColumns + `
+		FROM posts p
+		LEFT JOIN users u ON p.user_id = u.id
+		WHERE p.id = ANY($2) AND` + visibleToViewer + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]PostWithMetadata, len(postIDs))
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.User.Username,
+			&p.CommentCount,
+			&p.Reactions,
+			pq.Array(&p.ReactedByMe),
+		)
+		if err != nil {
+			return nil, err
+		}
+		byID[p.ID] = p
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := make([]PostWithMetadata, 0, len(byID))
+	for _, id := range postIDs {
+		if p, ok := byID[id]; ok {
+			posts = append(posts, p)
+		}
+	}
+
+	return posts, nil
 }
 
 func (s *PostStore) Delete(ctx context.Context, postID int64) error {
@@ -250,18 +551,9 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (cl *CommentList) Scan(src interface{}) error {
-	var source []byte
-	switch v := src.(type) {
-	case string:
-		source = []byte(v)
-	case []byte:
-		source = v
-	case nil:
-		*cl = CommentList{}
-		return nil
-	default:
-		return fmt.Errorf("unsupported type for CommentList scan: %T", src)
-	}
-	return json.Unmarshal(source, cl)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes the wildcards of a user search match literally in LIKE.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
 }
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Martins-Iroka/social/internal/ranking"
+)
+
+func TestRank(t *testing.T) {
+	// newest first, the way the candidates are selected
+	candidates := make([]PostWithMetadata, 5)
+	for i := range candidates {
+		createdAt := time.Now().Add(-time.Duration(i) * time.Hour).Format(time.RFC3339Nano)
+		candidates[i] = PostWithMetadata{Post: Post{ID: int64(i + 1), CreatedAt: createdAt}}
+	}
+	candidates[3].CommentCount = 10
+	interactions := make([]int, len(candidates))
+
+	tests := []struct {
+		name     string
+		offset   int
+		limit    int
+		wantIDs  []int64
+		wantMore bool
+	}{
+		{"should put the most commented post first", 0, 2, []int64{4, 1}, true},
+		{"should page through the ranking", 2, 2, []int64{2, 3}, true},
+		{"should end on the last candidates", 4, 2, []int64{5}, false},
+		{"should end on an exact page", 3, 2, []int64{3, 5}, false},
+		{"should return nothing past the candidates", 5, 2, []int64{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, more, err := rank(ranking.Top, candidates, interactions, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, p := range page {
+				ids = append(ids, p.ID)
+			}
+
+			if !slices.Equal(ids, tt.wantIDs) || more != tt.wantMore {
+				t.Errorf("expected %v, more %v; got %v, more %v", tt.wantIDs, tt.wantMore, ids, more)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		search   string
+		expected string
+	}{
+		{"gopher", "gopher"},
+		{"%", `\%`},
+		{"snake_case", `snake\_case`},
+		{`C:\go`, `C:\\go`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLike(tt.search); got != tt.expected {
+			t.Errorf("escapeLike(%q) = %q; want %q", tt.search, got, tt.expected)
+		}
+	}
+}
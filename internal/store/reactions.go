@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// ReactionKinds are the reactions a post accepts.
+var ReactionKinds = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// ReactionCounts is the number of reactions of a post per kind, kinds nobody
+// used are left out. It scans the jsonb object the post queries aggregate.
+type ReactionCounts map[string]int
+
+func (rc *ReactionCounts) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	case nil:
+		*rc = ReactionCounts{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into ReactionCounts", src)
+	}
+
+	counts := ReactionCounts{}
+	if err := json.Unmarshal(raw, &counts); err != nil {
+		return err
+	}
+	*rc = counts
+
+	return nil
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// React is idempotent: reacting twice with the same kind keeps one reaction.
+func (s *ReactionStore) React(ctx context.Context, postID, userID int64, kind string) error {
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id, kind) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unreact is idempotent as well, removing a reaction that isn't there is a no-op.
+func (s *ReactionStore) Unreact(ctx context.Context, postID, userID int64, kind string) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RevocationStore struct {
+	db *sql.DB
+}
+
+// Revoke blacklists a single access token by its jti until it expires.
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expiry) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, jti, userID, expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAllForUser kills every session of the user: access tokens issued up
+// to now and all of the user's refresh tokens. It returns the cut off time.
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, userID int64) (time.Time, error) {
+	var revokedAt time.Time
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		t, err := revokeAllForUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		revokedAt = t
+
+		return nil
+	})
+
+	return revokedAt, err
+}
+
+// IsRevoked reports whether the token was revoked by its jti or by a revoke
+// all sessions made after it was issued.
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+		OR EXISTS (SELECT 1 FROM user_token_revocations WHERE user_id = $2 AND revoked_at > $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, query, jti, userID, issuedAt.Truncate(time.Second)).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpired drops the revoked jtis whose tokens expired on their own.
+func (s *RevocationStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM revoked_tokens WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// RevokedBefore tells whether a token issued at issuedAt is cut off by a revoke
+// all sessions made at revokedAt. iat only has whole seconds, so the cutoff is
+// truncated too and a token issued in the same second as the revoke is kept.
+func RevokedBefore(issuedAt, revokedAt time.Time) bool {
+	return issuedAt.Unix() < revokedAt.Unix()
+}
+
+// revokeAllForUser is shared with the flows that have to end every session as
+// part of a bigger transaction (e.g. a password reset). The cut off is kept in
+// whole seconds, see RevokedBefore.
+func revokeAllForUser(ctx context.Context, tx *sql.Tx, userID int64) (time.Time, error) {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_at) VALUES ($1, date_trunc('second', NOW()))
+		ON CONFLICT (user_id) DO UPDATE SET revoked_at = EXCLUDED.revoked_at
+		RETURNING revoked_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revokedAt time.Time
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&revokedAt); err != nil {
+		return time.Time{}, err
+	}
+
+	query = `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return time.Time{}, err
+	}
+
+	return revokedAt, nil
+}
@@ -3,13 +3,35 @@ package store
 import (
 	"context"
 	"database/sql"
+
+	"github.com/lib/pq"
 )
 
 type Role struct {
-	ID          int64  `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Level       int    `json:"level"`
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Level       int      `json:"level"`
+	Permissions []string `json:"permissions"`
+	// MFARequired denies the role's permissions to sessions that didn't
+	// pass two-factor authentication
+	MFARequired bool `json:"mfa_required"`
+}
+
+// rolePermissions selects the permission names of roles.id.
+const rolePermissions = `
+	ARRAY(
+		SELECT p.name FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id
+		WHERE rp.role_id = roles.id ORDER BY p.name
+	)
+`
+
+// builtinRoles are seeded by the migrations and referenced by name in the
+// code, so they can't be modified.
+var builtinRoles = map[string]bool{
+	"user":      true,
+	"moderator": true,
+	"admin":     true,
 }
 
 type RoleStore struct {
@@ -17,7 +39,7 @@ type RoleStore struct {
 }
 
 func (r *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, error) {
-	query := `SELECT name, level FROM roles WHERE name = $1`
+	query := `SELECT id, name, COALESCE(description, ''), level, mfa_required, ` + rolePermissions + ` FROM roles WHERE name = $1`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -25,8 +47,12 @@ func (r *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, erro
 	var role Role
 
 	err := r.db.QueryRowContext(ctx, query, roleName).Scan(
+		&role.ID,
 		&role.Name,
+		&role.Description,
 		&role.Level,
+		&role.MFARequired,
+		pq.Array(&role.Permissions),
 	)
 
 	if err != nil {
@@ -40,3 +66,211 @@ func (r *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, erro
 
 	return &role, nil
 }
+
+func (r *RoleStore) GetByID(ctx context.Context, roleID int64) (*Role, error) {
+	query := `SELECT id, name, COALESCE(description, ''), level, mfa_required, ` + rolePermissions + ` FROM roles WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var role Role
+
+	err := r.db.QueryRowContext(ctx, query, roleID).Scan(
+		&role.ID,
+		&role.Name,
+		&role.Description,
+		&role.Level,
+		&role.MFARequired,
+		pq.Array(&role.Permissions),
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &role, nil
+}
+
+// GetAll lists the roles from the lowest level to the highest.
+func (r *RoleStore) GetAll(ctx context.Context) ([]Role, error) {
+	query := `SELECT id, name, COALESCE(description, ''), level, mfa_required, ` + rolePermissions + ` FROM roles ORDER BY level, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Level, &role.MFARequired, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *RoleStore) Create(ctx context.Context, role *Role) error {
+	query := `INSERT INTO roles (name, description, level, mfa_required) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	role.Permissions = []string{}
+
+	err := r.db.QueryRowContext(ctx, query, role.Name, role.Description, role.Level, role.MFARequired).Scan(&role.ID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorDuplicateRole
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Update returns ErrorBuiltinRole for the seeded roles.
+func (r *RoleStore) Update(ctx context.Context, role *Role) error {
+	return withTransaction(r.db, ctx, func(tx *sql.Tx) error {
+		if err := r.lockCustomRole(ctx, tx, role.ID); err != nil {
+			return err
+		}
+
+		query := `UPDATE roles SET name = $1, description = $2, level = $3, mfa_required = $4 WHERE id = $5`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.Level, role.MFARequired, role.ID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrorDuplicateRole
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+// SetPermissions replaces the permissions granted to the role, names that
+// aren't in the permissions table are ignored. It returns ErrorBuiltinRole for
+// the seeded roles.
+func (r *RoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return withTransaction(r.db, ctx, func(tx *sql.Tx) error {
+		if err := r.lockCustomRole(ctx, tx, roleID); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO role_permissions (role_id, permission_id)
+			SELECT $1, id FROM permissions WHERE name = ANY($2)
+		`
+
+		_, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+		return err
+	})
+}
+
+// lockCustomRole locks the role for the rest of the transaction, it returns
+// ErrorBuiltinRole for the seeded roles.
+func (r *RoleStore) lockCustomRole(ctx context.Context, tx *sql.Tx, roleID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var name string
+	err := tx.QueryRowContext(ctx, `SELECT name FROM roles WHERE id = $1 FOR UPDATE`, roleID).Scan(&name)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrorNotFound
+		default:
+			return err
+		}
+	}
+
+	if builtinRoles[name] {
+		return ErrorBuiltinRole
+	}
+
+	return nil
+}
+
+// Assign gives roleID to the user. It returns ErrorNotFound when either the
+// user or the role doesn't exist.
+func (r *RoleStore) Assign(ctx context.Context, userID, roleID int64) error {
+	query := `UPDATE users SET role_id = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := r.db.ExecContext(ctx, query, roleID, userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrorNotFound
+		}
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorNotFound
+	}
+
+	return nil
+}
+
+// GetUserIDs returns the IDs of the users holding roleID.
+func (r *RoleStore) GetUserIDs(ctx context.Context, roleID int64) ([]int64, error) {
+	query := `SELECT id FROM users WHERE role_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/Martins-Iroka/social/internal/totp"
 )
 
 var (
@@ -14,6 +16,13 @@ var (
 	ErrorUserUnFollowConflict = errors.New("you're unfollowing this user already")
 	ErrorDuplicateEmail       = errors.New("a user with that email already exists")
 	ErrorDuplicateUsername    = errors.New("a user with that username already exists")
+	ErrorRefreshTokenReused   = errors.New("refresh token has already been used")
+	ErrorBlocked              = errors.New("you can't interact with this user")
+	ErrorSelfFollow           = errors.New("you can't follow yourself")
+	ErrorDuplicateRole        = errors.New("a role with that name already exists")
+	ErrorBuiltinRole          = errors.New("built-in roles can't be modified")
+	ErrorMissingEmail         = errors.New("a verified email address is required")
+	ErrorTOTPUnavailable      = errors.New("two-factor authentication isn't configured")
 	QueryTimeoutDuration      = time.Second * 5
 )
 
@@ -22,36 +31,124 @@ type Storage struct {
 	Post interface {
 		Create(context.Context, *Post) error
 		GetByID(context.Context, int64) (*Post, error)
+		GetWithMetadata(ctx context.Context, postID, userID int64) (*PostWithMetadata, error)
 		GetUserFeed(
-			context.Context, int64, *PaginatedFeedQuery) ([]PostWithMetadata, error)
+			context.Context, int64, *PaginatedFeedQuery) ([]PostWithMetadata, string, error)
+		GetPosts(ctx context.Context, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error)
+		GetPostsByUser(ctx context.Context, authorID, userID int64, feedQuery *PaginatedFeedQuery) ([]PostWithMetadata, string, error)
+		GetUserFeedIDs(ctx context.Context, userID int64, limit int) ([]int64, error)
+		GetByIDs(ctx context.Context, postIDs []int64, userID int64) ([]PostWithMetadata, error)
 		Delete(context.Context, int64) error
 		Update(context.Context, *Post) error
 	}
 	User interface {
 		ActivateUser(ctx context.Context, token string) error
 		CreateUser(context.Context, *sql.Tx, *User) error
-		CreateAndInviteUser(ctx context.Context, user *User, token string, time time.Duration) error
+		CreateAndInviteUser(ctx context.Context, user *User, token string, time time.Duration, email *Email) error
 		GetUserByID(context.Context, int64) (*User, error)
-		FollowUser(context.Context, int64, int64) error
+		FollowUser(context.Context, int64, int64) (bool, error)
 		UnFollowUser(context.Context, int64, int64) error
+		GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error)
+		FollowsAny(ctx context.Context, followerID int64, userIDs []int64) (bool, error)
+		ListFollowers(ctx context.Context, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error)
+		ListFollowing(ctx context.Context, userID, viewerID int64, q *PaginatedFollowQuery) ([]Connection, string, error)
+		GetFollowStats(ctx context.Context, userID, viewerID int64) (*FollowStats, error)
+		ListFollowRequests(ctx context.Context, userID int64, q *PaginatedFollowQuery) ([]Connection, string, error)
+		ApproveFollowRequest(ctx context.Context, userID, followerID int64) error
+		DenyFollowRequest(ctx context.Context, userID, followerID int64) error
+		SetPrivate(ctx context.Context, userID int64, private bool) ([]int64, error)
+		CanViewPosts(ctx context.Context, authorID, viewerID int64) (bool, error)
+		GetFollowSuggestions(ctx context.Context, userID int64, limit int) ([]Suggestion, error)
 		DeleteUser(context.Context, int64) error
 		GetUserByEmail(context.Context, string) (*User, error)
+		CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *Email) error
+		ResetPassword(ctx context.Context, token string, newPassword string) (*User, time.Time, error)
+		GetPendingUserByEmail(context.Context, string) (*User, error)
+		RotateInvitation(ctx context.Context, userID int64, token string, invitationExp time.Duration, email *Email) error
+		DeleteExpiredInvitations(context.Context) (int64, error)
+		DeleteInactiveUsers(ctx context.Context, gracePeriod time.Duration) (int64, error)
 	}
 	Comment interface {
 		CreateComment(context.Context, *Comment) error
-		GetByPostID(ctx context.Context, postID int64) ([]Comment, error)
+		ListByPostID(ctx context.Context, postID int64, q *PaginatedCommentQuery) ([]Comment, string, error)
+		ListReplies(ctx context.Context, parentID int64, q *PaginatedCommentQuery) ([]Comment, string, error)
+		GetThread(ctx context.Context, commentID int64, q *CommentThreadQuery) (*Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+	}
+	Reactions interface {
+		React(ctx context.Context, postID, userID int64, kind string) error
+		Unreact(ctx context.Context, postID, userID int64, kind string) error
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+		Mute(ctx context.Context, muterID, mutedID int64) error
+		Unmute(ctx context.Context, muterID, mutedID int64) error
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
+		GetByID(context.Context, int64) (*Role, error)
+		GetAll(context.Context) ([]Role, error)
+		Create(context.Context, *Role) error
+		Update(context.Context, *Role) error
+		SetPermissions(ctx context.Context, roleID int64, permissions []string) error
+		Assign(ctx context.Context, userID, roleID int64) error
+		GetUserIDs(ctx context.Context, roleID int64) ([]int64, error)
+	}
+	RefreshTokens interface {
+		Create(ctx context.Context, token string, rt *RefreshToken) error
+		Rotate(ctx context.Context, token, newToken string, exp time.Duration) (*RefreshToken, error)
+		Revoke(ctx context.Context, token string, userID int64) error
+		DeleteExpired(ctx context.Context) (int64, error)
+	}
+	Revocations interface {
+		Revoke(ctx context.Context, jti string, userID int64, expiry time.Time) error
+		RevokeAllForUser(ctx context.Context, userID int64) (time.Time, error)
+		IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+		DeleteExpired(ctx context.Context) (int64, error)
+	}
+	Identities interface {
+		CreateLoginState(ctx context.Context, state string, ls *OIDCLoginState) error
+		ConsumeLoginState(ctx context.Context, state string) (*OIDCLoginState, error)
+		DeleteExpiredLoginStates(ctx context.Context) (int64, error)
+		Login(ctx context.Context, identity *ExternalIdentity) (*User, error)
+	}
+	MFA interface {
+		GetTOTP(ctx context.Context, userID int64) (*TOTP, error)
+		SetPendingTOTP(ctx context.Context, userID int64, secret string) error
+		EnableTOTP(ctx context.Context, userID, counter int64, codes []string) error
+		UseTOTPCounter(ctx context.Context, userID, counter int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, code string) error
+		ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error
+		DisableTOTP(ctx context.Context, userID int64) error
+	}
+	Outbox interface {
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]Email, error)
+		MarkSent(ctx context.Context, id int64) error
+		MarkFailed(ctx context.Context, id int64, lastError string, nextAttempt time.Time) error
+		MarkDead(ctx context.Context, id int64, lastError string) error
 	}
 }
 
-func NewPostgresStorage(db *sql.DB) Storage {
+// NewPostgresStorage seals the TOTP secrets with secrets. Without it the
+// MFA store can't read or write them.
+func NewPostgresStorage(db *sql.DB, secrets *totp.SecretBox) Storage {
 	return Storage{
 		Post:    &PostStore{db: db},
 		User:    &UserStore{db: db},
 		Comment: &CommentStore{db: db},
 		Roles:   &RoleStore{db: db},
+
+		Reactions: &ReactionStore{db: db},
+		Blocks:    &BlockStore{db: db},
+
+		RefreshTokens: &RefreshTokenStore{db: db},
+		Revocations:   &RevocationStore{db: db},
+		Outbox:        &OutboxStore{db: db},
+		Identities:    &IdentityStore{db: db},
+		MFA:           &MFAStore{db: db, secrets: secrets},
 	}
 }
 
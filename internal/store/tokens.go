@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RefreshToken is the persisted side of a refresh token. The token itself is
+// never stored, only its sha256 hash (the same way user_invitations does it).
+// Every token issued by rotating another one shares the same FamilyID and
+// AMR, the methods the session was authenticated with.
+type RefreshToken struct {
+	UserID    int64      `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	AMR       []string   `json:"amr"`
+	Expiry    time.Time  `json:"expiry"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token string, rt *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (token, user_id, family_id, amr, expiry) VALUES ($1, $2, $3, $4, $5)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken(token), rt.UserID, rt.FamilyID, pq.Array(rt.AMR), rt.Expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rotate exchanges a refresh token for newToken. The old token is revoked and
+// the new one joins the same family. Presenting a token that was already
+// rotated means it leaked, so the whole family is revoked and
+// ErrorRefreshTokenReused is returned.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, token, newToken string, exp time.Duration) (*RefreshToken, error) {
+	var rt *RefreshToken
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		// 1. find and lock the presented token
+		current, err := s.getForUpdate(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		rt = current
+
+		// 2. a revoked token being presented again is a reuse
+		if current.RevokedAt != nil {
+			return ErrorRefreshTokenReused
+		}
+
+		if time.Now().After(current.Expiry) {
+			return ErrorNotFound
+		}
+
+		// 3. revoke it and issue the next one in the family
+		if err := s.revoke(ctx, tx, token); err != nil {
+			return err
+		}
+
+		rt = &RefreshToken{
+			UserID:   current.UserID,
+			FamilyID: current.FamilyID,
+			AMR:      current.AMR,
+			Expiry:   time.Now().Add(exp),
+		}
+
+		return s.create(ctx, tx, newToken, rt)
+	})
+
+	if errors.Is(err, ErrorRefreshTokenReused) {
+		// the transaction was rolled back, so the family is revoked on its own
+		if err := s.revokeFamily(ctx, rt.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrorRefreshTokenReused
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// Revoke ends the session the refresh token belongs to by revoking its family.
+// A token of another user is left alone.
+func (s *RefreshTokenStore) Revoke(ctx context.Context, token string, userID int64) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = $1 AND user_id = $2)
+		AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken(token), userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired drops the refresh tokens that can't be rotated anymore. A
+// deleted token presented again is unknown instead of reused, which is fine
+// since it expired.
+func (s *RefreshTokenStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *RefreshTokenStore) getForUpdate(ctx context.Context, tx *sql.Tx, token string) (*RefreshToken, error) {
+	query := `
+		SELECT user_id, family_id, amr, expiry, revoked_at FROM refresh_tokens
+		WHERE token = $1 FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var rt RefreshToken
+	err := tx.QueryRowContext(ctx, query, hashToken(token)).Scan(
+		&rt.UserID,
+		&rt.FamilyID,
+		pq.Array(&rt.AMR),
+		&rt.Expiry,
+		&rt.RevokedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rt, nil
+}
+
+func (s *RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token string, rt *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (token, user_id, family_id, amr, expiry) VALUES ($1, $2, $3, $4, $5)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken(token), rt.UserID, rt.FamilyID, pq.Array(rt.AMR), rt.Expiry)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) revoke(ctx context.Context, tx *sql.Tx, token string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE token = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) revokeFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// hashToken is how every one-time token is stored: hex encoded sha256.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
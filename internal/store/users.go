@@ -2,11 +2,8 @@ package store
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/hex"
 	"errors"
-	"log"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,8 +17,12 @@ type User struct {
 	Password  password `json:"-"` // - indicates that password won't be returned to the user upon calling the endpoint.
 	CreatedAt string   `json:"created_at"`
 	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
+	IsPrivate bool     `json:"is_private"`
+	// MFAEnabled is set once the user confirmed a TOTP enrollment
+	MFAEnabled bool   `json:"mfa_enabled"`
+	Locale     string `json:"locale"`
+	RoleID     int64  `json:"role_id"`
+	Role       Role   `json:"role"`
 }
 
 type Follower struct {
@@ -56,9 +57,9 @@ func (p *password) ComparePassword(plainText string) error {
 
 func (s *UserStore) CreateUser(ctx context.Context, tx *sql.Tx, user *User) error {
 	query := `
-		INSERT INTO users (username, password, email, role_id) 
-		VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4))
-		RETURNING id, created_at 
+		INSERT INTO users (username, password, email, role_id, locale) 
+		VALUES ($1, $2, $3, (SELECT id FROM roles WHERE name = $4), COALESCE(NULLIF($5, ''), 'en'))
+		RETURNING id, created_at, locale
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -71,9 +72,11 @@ func (s *UserStore) CreateUser(ctx context.Context, tx *sql.Tx, user *User) erro
 		user.Password.hash,
 		user.Email,
 		user.Role.Name,
+		user.Locale,
 	).Scan(
 		&user.ID,
 		&user.CreatedAt,
+		&user.Locale,
 	); err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -88,7 +91,8 @@ func (s *UserStore) CreateUser(ctx context.Context, tx *sql.Tx, user *User) erro
 	return nil
 }
 
-func (s *UserStore) CreateAndInviteUser(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// CreateAndInviteUser creates the user, the invitation and queues the invitation email in one transaction.
+func (s *UserStore) CreateAndInviteUser(ctx context.Context, user *User, token string, invitationExp time.Duration, email *Email) error {
 	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.CreateUser(ctx, tx, user); err != nil {
 			return err
@@ -98,13 +102,18 @@ func (s *UserStore) CreateAndInviteUser(ctx context.Context, user *User, token s
 			return err
 		}
 
+		if err := enqueueEmail(ctx, tx, email); err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
 
 func (s *UserStore) GetUserByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, is_active, roles.* FROM users 
+		SELECT users.id, username, email, is_active, is_private, totp_enabled, locale,
+		roles.id, roles.name, roles.level, COALESCE(roles.description, ''), roles.mfa_required, ` + rolePermissions + ` FROM users
 		JOIN roles ON (users.role_id = roles.id)
 		WHERE users.id = $1 AND is_active = true
 	`
@@ -119,10 +128,15 @@ func (s *UserStore) GetUserByID(ctx context.Context, userID int64) (*User, error
 		&user.Username,
 		&user.Email,
 		&user.IsActive,
+		&user.IsPrivate,
+		&user.MFAEnabled,
+		&user.Locale,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
 		&user.Role.Description,
+		&user.Role.MFARequired,
+		pq.Array(&user.Role.Permissions),
 	)
 
 	if err != nil {
@@ -137,45 +151,190 @@ func (s *UserStore) GetUserByID(ctx context.Context, userID int64) (*User, error
 	return &user, nil
 }
 
-func (s *UserStore) FollowUser(ctx context.Context, followerID int64, userID int64) error {
-	query := `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+// FollowUser follows userID right away, or files a follow request when their
+// account is private, in which case pending is true. It returns
+// ErrorSelfFollow, ErrorNotFound when userID isn't an active user and
+// ErrorBlocked when either user blocked the other.
+func (s *UserStore) FollowUser(ctx context.Context, followerID int64, userID int64) (bool, error) {
+	if followerID == userID {
+		return false, ErrorSelfFollow
+	}
+
+	var pending bool
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		private, err := s.isPrivate(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		table := "followers"
+		if private {
+			following, err := s.isFollowing(ctx, tx, followerID, userID)
+			if err != nil {
+				return err
+			}
+			if following {
+				return ErrorUserFollowConflict
+			}
+			table = "follow_requests"
+		}
+
+		if err := s.follow(ctx, tx, table, followerID, userID); err != nil {
+			return err
+		}
+
+		pending = private
+		return nil
+	})
+
+	return pending, err
+}
+
+// follow inserts into followers or follow_requests, table being one of the two.
+func (s *UserStore) follow(ctx context.Context, tx *sql.Tx, table string, followerID, userID int64) error {
+	query := `
+		INSERT INTO ` + table + ` (user_id, follower_id)
+		SELECT $1, $2 WHERE NOT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
 
 	c, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(c, query, userID, followerID)
+	res, err := tx.ExecContext(c, query, userID, followerID)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrorUserFollowConflict
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrorUserFollowConflict
+			case "23503":
+				// the user was deleted since it was looked up
+				return ErrorNotFound
+			}
 		}
 		return err
 	}
-	return err
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if row == 0 {
+		return ErrorBlocked
+	}
+
+	return nil
 }
 
+// UnFollowUser unfollows userID or cancels the pending request to follow them.
 func (s *UserStore) UnFollowUser(ctx context.Context, followerID int64, userID int64) error {
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+	query := `
+		WITH f AS (
+			DELETE FROM followers WHERE user_id = $1 AND follower_id = $2 RETURNING 1
+		), r AS (
+			DELETE FROM follow_requests WHERE user_id = $1 AND follower_id = $2 RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM f) + (SELECT COUNT(*) FROM r)
+	`
 
 	c, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	res, err := s.db.ExecContext(c, query, userID, followerID)
-	log.Println(err)
-	if err != nil {
+	var row int64
+	if err := s.db.QueryRowContext(c, query, userID, followerID).Scan(&row); err != nil {
 		return err
 	}
 
-	row, err := res.RowsAffected()
+	if row == 0 {
+		return ErrorNotFound
+	}
 
+	return nil
+}
+
+func (s *UserStore) isPrivate(ctx context.Context, tx *sql.Tx, userID int64) (bool, error) {
+	query := `SELECT is_private FROM users WHERE id = $1 AND is_active = true`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var private bool
+	err := tx.QueryRowContext(ctx, query, userID).Scan(&private)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrorNotFound
+		default:
+			return false, err
+		}
 	}
 
-	if row == 0 {
-		return ErrorNotFound
+	return private, nil
+}
+
+func (s *UserStore) isFollowing(ctx context.Context, tx *sql.Tx, followerID, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var following bool
+	if err := tx.QueryRowContext(ctx, query, userID, followerID).Scan(&following); err != nil {
+		return false, err
 	}
 
-	return nil
+	return following, nil
+}
+
+// GetFollowerIDs returns the IDs of up to limit followers of the user, leaving
+// out the ones who muted them.
+func (s *UserStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	query := `
+		SELECT follower_id FROM followers f
+		WHERE f.user_id = $1
+		AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = f.follower_id AND m.muted_id = $1)
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FollowsAny reports whether the follower follows at least one of userIDs.
+func (s *UserStore) FollowsAny(ctx context.Context, followerID int64, userIDs []int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM followers WHERE follower_id = $1 AND user_id = ANY($2))`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var follows bool
+	err := s.db.QueryRowContext(ctx, query, followerID, pq.Array(userIDs)).Scan(&follows)
+	if err != nil {
+		return false, err
+	}
+
+	return follows, nil
 }
 
 func (s *UserStore) ActivateUser(ctx context.Context, token string) error {
@@ -218,7 +377,7 @@ func (s *UserStore) DeleteUser(ctx context.Context, userID int64) error {
 
 func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, password FROM users WHERE email = $1 AND is_active = true
+		SELECT id, username, email, locale, password, totp_enabled FROM users WHERE email = $1 AND is_active = true
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -228,7 +387,11 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 
 	err := s.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Locale,
 		&user.Password.hash,
+		&user.MFAEnabled,
 	)
 
 	if err != nil {
@@ -243,6 +406,181 @@ func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, er
 	return &user, nil
 }
 
+// CreatePasswordReset replaces any pending reset of the user with the (hashed) token and queues the email.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration, email *Email) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		if err := s.createPasswordReset(ctx, tx, userID, token, exp); err != nil {
+			return err
+		}
+
+		if err := enqueueEmail(ctx, tx, email); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// ResetPassword sets a new password for the owner of the reset token and
+// revokes all of the user's sessions. It returns the cut off of the revoked
+// sessions.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, newPassword string) (*User, time.Time, error) {
+	var user *User
+	var revokedAt time.Time
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		// 1. find the user that this token belongs to
+		u, err := s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		user = u
+
+		// 2. update the password
+		if err := user.Password.Set(newPassword); err != nil {
+			return err
+		}
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		// 3. the token can only be used once
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		// 4. whoever knew the old password is logged out
+		t, err := revokeAllForUser(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		revokedAt = t
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return user, revokedAt, nil
+}
+
+// GetPendingUserByEmail finds a user that registered but never activated the
+// account. The email is matched case insensitively.
+func (s *UserStore) GetPendingUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, username, email, locale, created_at FROM users
+		WHERE email = $1::citext AND is_active = false
+		AND EXISTS (SELECT 1 FROM user_invitations WHERE user_id = users.id)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var user User
+
+	err := s.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Locale,
+		&user.CreatedAt,
+	)
+
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// RotateInvitation replaces the pending invitations of the user with the (hashed) token and queues the email.
+func (s *UserStore) RotateInvitation(ctx context.Context, userID int64, token string, invitationExp time.Duration, email *Email) error {
+	return withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, userID); err != nil {
+			return err
+		}
+
+		if err := enqueueEmail(ctx, tx, email); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// DeleteExpiredInvitations keeps the expired invitations of the accounts that
+// are still pending, DeleteInactiveUsers needs them to tell those accounts
+// apart and deletes them with the account.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM user_invitations ui USING users u
+		WHERE ui.user_id = u.id AND ui.expiry <= $1 AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteInactiveUsers removes the accounts that were never activated within
+// gracePeriod of registering. Accounts are pending as long as they have an
+// invitation, expired or not, deactivated accounts are left alone. An account
+// with an invitation that hasn't expired yet (e.g. a resent one) is kept.
+func (s *UserStore) DeleteInactiveUsers(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+	var deleted int64
+
+	err := withTransaction(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		now := time.Now()
+		cutoff := now.Add(-gracePeriod)
+
+		query := `
+			WITH pending AS (
+				DELETE FROM user_invitations ui USING users u
+				WHERE ui.user_id = u.id AND u.is_active = false AND u.created_at < $1
+				AND NOT EXISTS (
+					SELECT 1 FROM user_invitations live WHERE live.user_id = u.id AND live.expiry > $2
+				)
+				RETURNING ui.user_id
+			)
+			DELETE FROM users WHERE id IN (SELECT user_id FROM pending)
+		`
+		res, err := tx.ExecContext(ctx, query, cutoff, now)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		return err
+	})
+
+	return deleted, err
+}
+
 func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `DELETE FROM users WHERE id = $1`
 
@@ -263,14 +601,11 @@ func (s *UserStore) getuserFromInvitationI(ctx context.Context, tx *sql.Tx, toke
 		WHERE ui.token = $1 AND ui.expiry > $2
 	`
 
-	hash := sha256.Sum256([]byte(token))
-	hashToken := hex.EncodeToString(hash[:])
-
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
 	user := &User{}
-	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -330,3 +665,72 @@ func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userI
 
 	return nil
 }
+
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email FROM users u JOIN password_resets pr ON u.id = pr.user_id
+		WHERE pr.token = $1 AND pr.expiry > $2 AND u.is_active = true
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, hashToken(token), time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) createPasswordReset(ctx context.Context, tx *sql.Tx, userID int64, token string, exp time.Duration) error {
+	query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
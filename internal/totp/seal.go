@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of the key secrets are sealed with, AES-256.
+const KeySize = 32
+
+// sealedPrefix versions the format of sealed secrets, so it can change
+// without guessing what a stored value is.
+const sealedPrefix = "v1:"
+
+var errNotSealed = errors.New("totp: secret is not sealed")
+
+// SecretBox encrypts secrets before they're stored, so a copy of the
+// database alone doesn't let anyone generate codes. A secret is bound to the
+// user it was sealed for and can't be moved to another one.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox takes a key of KeySize bytes.
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("totp: key must be %d bytes; got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead}, nil
+}
+
+// Seal returns the encrypted secret of the user, base64 encoded.
+func (b *SecretBox) Seal(userID int64, secret string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, []byte(secret), userData(userID))
+
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret Seal returned for the same user.
+func (b *SecretBox) Open(userID int64, sealed string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return "", errNotSealed
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	size := b.aead.NonceSize()
+	if len(data) < size {
+		return "", errNotSealed
+	}
+
+	secret, err := b.aead.Open(nil, data[:size], data[size:], userData(userID))
+	if err != nil {
+		return "", err
+	}
+
+	return string(secret), nil
+}
+
+func userData(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSecretBox(t *testing.T) {
+	box, err := NewSecretBox(bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := box.Seal(42, rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should not store the secret as is", func(t *testing.T) {
+		if strings.Contains(sealed, rfcSecret) {
+			t.Errorf("expected the secret to be encrypted; got %s", sealed)
+		}
+	})
+
+	t.Run("should open a sealed secret", func(t *testing.T) {
+		got, err := box.Open(42, sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != rfcSecret {
+			t.Errorf("expected %s, got %s", rfcSecret, got)
+		}
+	})
+
+	t.Run("should only open the secret for its user", func(t *testing.T) {
+		if _, err := box.Open(7, sealed); err == nil {
+			t.Error("expected the secret of another user to be rejected")
+		}
+	})
+
+	t.Run("should not open with another key", func(t *testing.T) {
+		other, err := NewSecretBox(bytes.Repeat([]byte{2}, KeySize))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := other.Open(42, sealed); err == nil {
+			t.Error("expected another key to be rejected")
+		}
+	})
+
+	t.Run("should reject secrets that aren't sealed", func(t *testing.T) {
+		for _, value := range []string{rfcSecret, sealedPrefix, sealedPrefix + "!"} {
+			if _, err := box.Open(42, value); err == nil {
+				t.Errorf("expected %q to be rejected", value)
+			}
+		}
+	})
+
+	t.Run("should require a key of the right size", func(t *testing.T) {
+		if _, err := NewSecretBox([]byte("short")); err == nil {
+			t.Error("expected a short key to be rejected")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the RFC 4226 appendix D secret
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		if got := hotp([]byte("12345678901234567890"), int64(counter), 6); got != code {
+			t.Errorf("counter %d: expected %s, got %s", counter, code, got)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	// the SHA1 vectors of RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	t.Run("should accept the current and adjacent steps", func(t *testing.T) {
+		for _, at := range []time.Time{now.Add(-Period), now, now.Add(Period)} {
+			code, err := Code(rfcSecret, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counter, ok := Validate(rfcSecret, code, now)
+			if !ok {
+				t.Errorf("expected the code of %v to be accepted", at)
+			}
+			if counter != Counter(at) {
+				t.Errorf("expected counter %d, got %d", Counter(at), counter)
+			}
+		}
+	})
+
+	t.Run("should reject codes outside the skew", func(t *testing.T) {
+		code, err := Code(rfcSecret, now.Add(-Period*2))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Error("expected an old code to be rejected")
+		}
+	})
+
+	t.Run("should reject malformed codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			if _, ok := Validate(rfcSecret, code, now); ok {
+				t.Errorf("expected %q to be rejected", code)
+			}
+		}
+	})
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Validate(secret, code, time.Now()); !ok {
+		t.Error("expected a code of a generated secret to validate")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("GopherSocial", "gopher@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/GopherSocial:gopher@example.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=GopherSocial", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("expected %s in %s", param, uri)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := RecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("unexpected format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		if got := NormalizeRecoveryCode(" " + strings.ToUpper(code) + " "); got != strings.ReplaceAll(code, "-", "") {
+			t.Errorf("unexpected normalized code %q", got)
+		}
+	}
+}